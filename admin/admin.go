@@ -0,0 +1,65 @@
+// Package admin 提供服务端的调试 HTTP 接口
+//
+// 路由:
+//   - /debug/mrpc: 服务端的完整状态
+//   - /debug/mrpc/services、/debug/mrpc/conns、/debug/mrpc/inflight、/debug/mrpc/serializers、/debug/mrpc/errors: 各部分状态
+//   - /debug/pprof/: net/http/pprof
+//
+// 接口没有鉴权，只应该监听在内网地址上
+package admin
+
+import (
+	"encoding/json"
+	"github.com/NotFound1911/mrpc"
+	"net/http"
+	"net/http/pprof"
+)
+
+// Handler 返回调试接口
+func Handler(server *mrpc.Server) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(path string, part func(snapshot *mrpc.ServerSnapshot) any) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, part(server.Snapshot()))
+		})
+	}
+	handle("/debug/mrpc", func(snapshot *mrpc.ServerSnapshot) any {
+		return snapshot
+	})
+	handle("/debug/mrpc/services", func(snapshot *mrpc.ServerSnapshot) any {
+		return snapshot.Services
+	})
+	handle("/debug/mrpc/conns", func(snapshot *mrpc.ServerSnapshot) any {
+		return snapshot.Conns
+	})
+	handle("/debug/mrpc/inflight", func(snapshot *mrpc.ServerSnapshot) any {
+		return snapshot.Inflight
+	})
+	handle("/debug/mrpc/serializers", func(snapshot *mrpc.ServerSnapshot) any {
+		return snapshot.Serializers
+	})
+	handle("/debug/mrpc/errors", func(snapshot *mrpc.ServerSnapshot) any {
+		return snapshot.RecentErrors
+	})
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// ListenAndServe 在 addr 上启动调试接口
+func ListenAndServe(addr string, server *mrpc.Server) error {
+	return http.ListenAndServe(addr, Handler(server))
+}
+
+func writeJSON(w http.ResponseWriter, val any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(val); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/NotFound1911/mrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type GetByIdReq struct {
+	Id int
+}
+
+type GetByIdResp struct {
+	Name string
+}
+
+type UserService struct {
+	GetById func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+}
+
+func (u UserService) Name() string {
+	return "user-service"
+}
+
+// UserServiceServer Id 为 0 时返回错误，否则等待 release
+type UserServiceServer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (u *UserServiceServer) Name() string {
+	return "user-service"
+}
+
+func (u *UserServiceServer) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	if req.Id == 0 {
+		return nil, errors.New("id 不能为空")
+	}
+	u.started <- struct{}{}
+	<-u.release
+	return &GetByIdResp{Name: "Tom"}, nil
+}
+
+func TestHandler(t *testing.T) {
+	server := mrpc.NewServer()
+	service := &UserServiceServer{started: make(chan struct{}), release: make(chan struct{})}
+	server.RegisterService(service)
+	go func() {
+		err := server.Start("tcp", ":8101")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	client, err := mrpc.NewClient(":8101")
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = usClient.GetById(ctx, &GetByIdReq{})
+	assert.EqualError(t, err, "id 不能为空")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := usClient.GetById(ctx, &GetByIdReq{Id: 1})
+		assert.NoError(t, err)
+	}()
+	<-service.started
+	defer func() {
+		close(service.release)
+		<-done
+	}()
+
+	handler := Handler(server)
+	get := func(path string, val any) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), val))
+	}
+
+	var snapshot mrpc.ServerSnapshot
+	get("/debug/mrpc", &snapshot)
+	require.Len(t, snapshot.Services, 1)
+	assert.Equal(t, "user-service", snapshot.Services[0].Name)
+	assert.Equal(t, []mrpc.SerializerInfo{{Name: "json", Code: 1}}, snapshot.Serializers)
+
+	// 出错的请求已经完成，连接池中可能有多个连接
+	var conns []mrpc.ConnInfo
+	get("/debug/mrpc/conns", &conns)
+	require.NotEmpty(t, conns)
+	var requests int64
+	for _, conn := range conns {
+		assert.NotEmpty(t, conn.Peer)
+		assert.Greater(t, conn.Age, time.Duration(0))
+		requests += conn.Requests
+	}
+	assert.Equal(t, int64(1), requests)
+
+	var inflight []mrpc.InflightInfo
+	get("/debug/mrpc/inflight", &inflight)
+	require.Len(t, inflight, 1)
+	assert.Equal(t, "GetById", inflight[0].Method)
+	assert.NotEmpty(t, inflight[0].Peer)
+
+	var recentErrors []mrpc.ErrorInfo
+	get("/debug/mrpc/errors", &recentErrors)
+	require.Len(t, recentErrors, 1)
+	assert.Equal(t, "Unknown", recentErrors[0].Code)
+	assert.Equal(t, "id 不能为空", recentErrors[0].Message)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Rule 一条授权规则
+// Principals 与 Roles 都为空时规则对所有调用方生效
+// Services 与 Methods 支持 path.Match 通配符，为空时匹配所有
+type Rule struct {
+	Principals []string `json:"principals" yaml:"principals"`
+	Roles      []string `json:"roles" yaml:"roles"`
+	Services   []string `json:"services" yaml:"services"`
+	Methods    []string `json:"methods" yaml:"methods"`
+	Effect     Effect   `json:"effect" yaml:"effect"`
+}
+
+func (r Rule) matchPrincipal(p *Principal) bool {
+	if len(r.Principals) == 0 && len(r.Roles) == 0 {
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	for _, name := range r.Principals {
+		if name == "*" || name == p.Name {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		for _, has := range p.Roles {
+			if role == has {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy 授权策略
+// 命中 deny 规则直接拒绝，否则必须命中 allow 规则，默认拒绝
+type Policy struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+func (p *Policy) Allowed(principal *Principal, service, method string) bool {
+	allowed := false
+	for _, r := range p.Rules {
+		if !r.matchPrincipal(principal) || !matchAny(r.Services, service) || !matchAny(r.Methods, method) {
+			continue
+		}
+		if r.Effect == Deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func (p *Policy) validate() error {
+	for i, r := range p.Rules {
+		if r.Effect != Allow && r.Effect != Deny {
+			return fmt.Errorf("auth: 第 %d 条规则的 effect 非法 %q", i, r.Effect)
+		}
+		for _, pattern := range append(append([]string{}, r.Services...), r.Methods...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("auth: 第 %d 条规则的匹配模式非法 %q", i, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// ParsePolicy 根据 format 解析策略，支持 json 和 yaml
+func ParsePolicy(data []byte, format string) (*Policy, error) {
+	p := &Policy{}
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, p)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, p)
+	default:
+		return nil, fmt.Errorf("auth: 不支持的策略格式 %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadPolicyFile 根据文件后缀选择解析格式
+func LoadPolicyFile(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		return nil, fmt.Errorf("auth: 无法识别策略文件格式 %s", filename)
+	}
+	return ParsePolicy(data, ext[1:])
+}
+
+// Authorizer 服务端鉴权，判断调用方能否调用某个方法
+type Authorizer interface {
+	Authorize(ctx context.Context, p *Principal, service, method string) error
+}
+
+// ACL 基于 Policy 的鉴权实现，策略可以热更新
+type ACL struct {
+	policy   atomic.Pointer[Policy]
+	filename string
+
+	mutex   sync.Mutex
+	modTime time.Time
+}
+
+func NewACL(p *Policy) *ACL {
+	res := &ACL{}
+	res.policy.Store(p)
+	return res
+}
+
+// NewFileACL 从文件加载策略，之后可以通过 Reload 或 Watch 热更新
+func NewFileACL(filename string) (*ACL, error) {
+	res := &ACL{filename: filename}
+	if err := res.Reload(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reload 重新加载策略文件，加载失败时保留原有策略
+func (a *ACL) Reload() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.reload(false)
+}
+
+// reload onlyModified 为 true 时，文件未修改则跳过
+func (a *ACL) reload(onlyModified bool) error {
+	if a.filename == "" {
+		return errors.New("auth: ACL 没有关联策略文件")
+	}
+	info, err := os.Stat(a.filename)
+	if err != nil {
+		return err
+	}
+	if onlyModified && info.ModTime().Equal(a.modTime) {
+		return nil
+	}
+	p, err := LoadPolicyFile(a.filename)
+	if err != nil {
+		return err
+	}
+	a.policy.Store(p)
+	a.modTime = info.ModTime()
+	return nil
+}
+
+// Watch 定期检查策略文件，文件修改后自动重新加载，直到 ctx 结束
+// 加载失败的策略会交给 onErr 处理，原有策略继续生效
+func (a *ACL) Watch(ctx context.Context, interval time.Duration, onErr func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.mutex.Lock()
+			err := a.reload(true)
+			a.mutex.Unlock()
+			if err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}
+}
+
+func (a *ACL) Authorize(ctx context.Context, p *Principal, service, method string) error {
+	if !a.policy.Load().Allowed(p, service, method) {
+		name := ""
+		if p != nil {
+			name = p.Name
+		}
+		return status.Errorf(status.PermissionDenied, "auth: %s 无权调用 %s.%s", name, service, method)
+	}
+	return nil
+}
+
+// AuthorizeInterceptor 鉴权拦截器，需要放在认证拦截器之后
+// 批量请求本身不鉴权，其中的每一个子请求单独鉴权
+func AuthorizeInterceptor(a Authorizer) mrpc.Interceptor {
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			if req.ServiceName == mrpc.BatchServiceName {
+				return next(ctx, req)
+			}
+			p, _ := PrincipalFromCtx(ctx)
+			if err := a.Authorize(ctx, p, req.ServiceName, req.MethodName); err != nil {
+				if status.CodeOf(err) != status.PermissionDenied {
+					err = status.New(status.PermissionDenied, err.Error())
+				}
+				return nil, err
+			}
+			return next(ctx, req)
+		}
+	}
+}
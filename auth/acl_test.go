@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Allowed(t *testing.T) {
+	policy := &Policy{
+		Rules: []Rule{
+			{
+				Roles:    []string{"service-account"},
+				Services: []string{"user-service"},
+				Effect:   Allow,
+			},
+			{
+				Roles:   []string{"service-account"},
+				Methods: []string{"Admin*"},
+				Effect:  Deny,
+			},
+			{
+				Roles:  []string{"admin"},
+				Effect: Allow,
+			},
+		},
+	}
+	account := &Principal{Name: "order", Roles: []string{"service-account"}}
+	admin := &Principal{Name: "ops", Roles: []string{"admin", "service-account"}}
+	testCases := []struct {
+		name      string
+		principal *Principal
+		service   string
+		method    string
+		wantRes   bool
+	}{
+		{
+			name:      "allowed",
+			principal: account,
+			service:   "user-service",
+			method:    "GetById",
+			wantRes:   true,
+		},
+		{
+			name:      "other service",
+			principal: account,
+			service:   "order-service",
+			method:    "GetById",
+		},
+		{
+			name:      "admin method",
+			principal: account,
+			service:   "user-service",
+			method:    "AdminDeleteUser",
+		},
+		{
+			// deny 优先于 allow
+			name:      "admin with service account role",
+			principal: admin,
+			service:   "user-service",
+			method:    "AdminDeleteUser",
+		},
+		{
+			name:      "admin",
+			principal: admin,
+			service:   "order-service",
+			method:    "GetById",
+			wantRes:   true,
+		},
+		{
+			name:    "no principal",
+			service: "user-service",
+			method:  "GetById",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantRes, policy.Allowed(tc.principal, tc.service, tc.method))
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	want := &Policy{
+		Rules: []Rule{
+			{
+				Principals: []string{"order"},
+				Services:   []string{"user-service"},
+				Methods:    []string{"Get*"},
+				Effect:     Allow,
+			},
+		},
+	}
+	testCases := []struct {
+		name    string
+		data    string
+		format  string
+		wantRes *Policy
+		wantErr bool
+	}{
+		{
+			name:    "json",
+			format:  "json",
+			data:    `{"rules":[{"principals":["order"],"services":["user-service"],"methods":["Get*"],"effect":"allow"}]}`,
+			wantRes: want,
+		},
+		{
+			name:   "yaml",
+			format: "yaml",
+			data: `
+rules:
+  - principals: [order]
+    services: [user-service]
+    methods: ["Get*"]
+    effect: allow
+`,
+			wantRes: want,
+		},
+		{
+			name:    "invalid effect",
+			format:  "json",
+			data:    `{"rules":[{"effect":"maybe"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			format:  "json",
+			data:    `{"rules":[{"methods":["["],"effect":"allow"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			format:  "toml",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ParsePolicy([]byte(tc.data), tc.format)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRes, p)
+		})
+	}
+}
+
+func TestACL_Watch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "acl.json")
+	require.NoError(t, os.WriteFile(filename,
+		[]byte(`{"rules":[{"principals":["order"],"effect":"allow"}]}`), 0644))
+	acl, err := NewFileACL(filename)
+	require.NoError(t, err)
+	order := &Principal{Name: "order"}
+	assert.NoError(t, acl.Authorize(context.Background(), order, "user-service", "GetById"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go acl.Watch(ctx, 10*time.Millisecond, nil)
+
+	require.NoError(t, os.WriteFile(filename,
+		[]byte(`{"rules":[{"principals":["order"],"methods":["List*"],"effect":"allow"}]}`), 0644))
+	// 保证修改时间发生变化
+	require.NoError(t, os.Chtimes(filename, time.Now(), time.Now().Add(time.Second)))
+	assert.Eventually(t, func() bool {
+		err = acl.Authorize(context.Background(), order, "user-service", "GetById")
+		return status.CodeOf(err) == status.PermissionDenied
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestAuthorizeInterceptor(t *testing.T) {
+	acl := NewACL(&Policy{
+		Rules: []Rule{{Principals: []string{"order"}, Methods: []string{"Get*"}, Effect: Allow}},
+	})
+	next := func(ctx context.Context, req *message.Request) (*message.Response, error) {
+		return &message.Response{}, nil
+	}
+	h := AuthorizeInterceptor(acl)(next)
+	ctx := CtxWithPrincipal(context.Background(), &Principal{Name: "order"})
+
+	_, err := h(ctx, &message.Request{ServiceName: "user-service", MethodName: "GetById"})
+	assert.NoError(t, err)
+	resp, err := h(ctx, &message.Request{ServiceName: "user-service", MethodName: "DeleteById"})
+	assert.Nil(t, resp)
+	assert.Equal(t, status.New(status.PermissionDenied, "auth: order 无权调用 user-service.DeleteById"), err)
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+)
+
+// Principal 认证通过后的调用方身份
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+// CredentialProvider 客户端凭证提供者，每次调用时生成需要写入 Request.Meta 的凭证
+type CredentialProvider interface {
+	Credentials(ctx context.Context, req *message.Request) (map[string]string, error)
+}
+
+// Authenticator 服务端认证器，根据请求中的凭证识别调用方
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *message.Request) (*Principal, error)
+}
+
+type principalKey struct{}
+
+func CtxWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromCtx 业务方法中获取调用方身份
+func PrincipalFromCtx(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ClientInterceptor 在每次调用前附加凭证
+func ClientInterceptor(p CredentialProvider) mrpc.Interceptor {
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			creds, err := p.Credentials(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			if req.Meta == nil {
+				req.Meta = make(map[string]string, len(creds))
+			}
+			for k, v := range creds {
+				req.Meta[k] = v
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// ServerInterceptor 认证失败的请求直接以 Unauthenticated 拒绝
+// 批量请求只认证一次，子请求沿用批量请求的调用方身份
+func ServerInterceptor(a Authenticator) mrpc.Interceptor {
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			if _, ok := PrincipalFromCtx(ctx); ok && mrpc.IsBatchSub(ctx) {
+				return next(ctx, req)
+			}
+			p, err := a.Authenticate(ctx, req)
+			if err != nil {
+				if status.CodeOf(err) != status.Unauthenticated {
+					err = status.New(status.Unauthenticated, err.Error())
+				}
+				return nil, err
+			}
+			return next(CtxWithPrincipal(ctx, p), req)
+		}
+	}
+}
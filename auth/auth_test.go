@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type WhoAmIService struct {
+	WhoAmI func(ctx context.Context, req *WhoAmIReq) (*WhoAmIResp, error)
+}
+
+func (w WhoAmIService) Name() string {
+	return "whoami-service"
+}
+
+type WhoAmIReq struct{}
+type WhoAmIResp struct {
+	Name string
+}
+
+type WhoAmIServiceServer struct{}
+
+func (w *WhoAmIServiceServer) WhoAmI(ctx context.Context, req *WhoAmIReq) (*WhoAmIResp, error) {
+	p, _ := PrincipalFromCtx(ctx)
+	return &WhoAmIResp{Name: p.Name}, nil
+}
+func (w *WhoAmIServiceServer) Name() string {
+	return "whoami-service"
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	server := mrpc.NewServer(mrpc.ServerWithInterceptors(ServerInterceptor(
+		NewStaticTokenAuthenticator(map[string]*Principal{
+			"token-alice": {Name: "alice"},
+		}))))
+	server.RegisterService(&WhoAmIServiceServer{})
+	go func() {
+		err := server.Start("tcp", ":8091")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	testCases := []struct {
+		name string
+		opts []mrpc.ClientOption
+
+		wantErr  error
+		wantResp *WhoAmIResp
+	}{
+		{
+			name: "authenticated",
+			opts: []mrpc.ClientOption{
+				mrpc.ClientWithInterceptors(ClientInterceptor(StaticToken("token-alice"))),
+			},
+			wantResp: &WhoAmIResp{Name: "alice"},
+		},
+		{
+			name:     "no token",
+			wantResp: &WhoAmIResp{},
+			wantErr:  status.New(status.Unauthenticated, "auth: 缺少 token"),
+		},
+		{
+			name: "invalid token",
+			opts: []mrpc.ClientOption{
+				mrpc.ClientWithInterceptors(ClientInterceptor(StaticToken("token-bob"))),
+			},
+			wantResp: &WhoAmIResp{},
+			wantErr:  status.New(status.Unauthenticated, "auth: 无效的 token"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := mrpc.NewClient(":8091", tc.opts...)
+			require.NoError(t, err)
+			service := &WhoAmIService{}
+			require.NoError(t, client.InitService(service))
+			resp, err := service.WhoAmI(context.Background(), &WhoAmIReq{})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantResp, resp)
+		})
+	}
+}
+
+func TestAuthInterceptorBatch(t *testing.T) {
+	secret := []byte("secret")
+	server := mrpc.NewServer(mrpc.ServerWithInterceptors(
+		ServerInterceptor(NewHMACAuthenticator(map[string]HMACKey{
+			"key-alice": {Secret: secret, Principal: &Principal{Name: "alice"}},
+		})),
+		AuthorizeInterceptor(NewACL(&Policy{Rules: []Rule{
+			{Principals: []string{"alice"}, Services: []string{"whoami-service"}, Methods: []string{"WhoAmI"}, Effect: Allow},
+		}})),
+	))
+	server.RegisterService(&WhoAmIServiceServer{})
+	go func() {
+		err := server.Start("tcp", ":8108")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	// 批量请求只签名、认证一次，子请求各自鉴权
+	client, err := mrpc.NewClient(":8108",
+		mrpc.ClientWithInterceptors(ClientInterceptor(NewHMACSigner("key-alice", secret))))
+	require.NoError(t, err)
+	defer client.Close()
+	results, err := client.Batch(context.Background()).
+		Add("whoami-service", "WhoAmI", &WhoAmIReq{}).
+		Add("whoami-service", "WhoAmI", &WhoAmIReq{}).
+		Add("whoami-service", "Admin", &WhoAmIReq{}).
+		Do()
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, result := range results[:2] {
+		resp := &WhoAmIResp{}
+		require.NoError(t, result.Decode(resp))
+		assert.Equal(t, "alice", resp.Name)
+	}
+	assert.Equal(t, status.PermissionDenied, status.CodeOf(results[2].Err))
+
+	// 没有签名的批量请求整体被拒绝
+	anonymous, err := mrpc.NewClient(":8108")
+	require.NoError(t, err)
+	defer anonymous.Close()
+	_, err = anonymous.Batch(context.Background()).Add("whoami-service", "WhoAmI", &WhoAmIReq{}).Do()
+	assert.Equal(t, status.Unauthenticated, status.CodeOf(err))
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/NotFound1911/mrpc/message"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MetaKeyID     = "x-mrpc-key-id"
+	MetaTimestamp = "x-mrpc-timestamp"
+	MetaNonce     = "x-mrpc-nonce"
+	MetaSignature = "x-mrpc-signature"
+)
+
+// signMeta 签名信息本身不参与签名
+var signMeta = map[string]struct{}{
+	MetaKeyID:     {},
+	MetaTimestamp: {},
+	MetaNonce:     {},
+	MetaSignature: {},
+}
+
+// sign 签名内容:
+// 服务名、方法名、时间戳、nonce、请求数据的摘要以及按 key 排序的元数据，以换行分隔
+// 元数据同样参与签名，超时时间、oneway 以及租户等都不能被篡改
+func sign(secret []byte, req *message.Request, timestamp, nonce string) string {
+	digest := sha256.Sum256(req.Data)
+	keys := make([]string, 0, len(req.Meta))
+	for k := range req.Meta {
+		if _, ok := signMeta[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, 5+len(keys))
+	lines = append(lines, req.ServiceName, req.MethodName, timestamp, nonce, hex.EncodeToString(digest[:]))
+	// 元数据中不会出现 \r 与 \n
+	for _, k := range keys {
+		lines = append(lines, k+"\r"+req.Meta[k])
+	}
+	canonical := strings.Join(lines, "\n")
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMACSigner 客户端使用共享密钥对每个请求签名
+// 签名覆盖元数据，会修改元数据的拦截器（例如 tracing）需要放在 ClientInterceptor 之前
+type HMACSigner struct {
+	keyID  string
+	secret []byte
+	now    func() time.Time
+}
+
+func NewHMACSigner(keyID string, secret []byte) *HMACSigner {
+	return &HMACSigner{
+		keyID:  keyID,
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+func (s *HMACSigner) Credentials(ctx context.Context, req *message.Request) (map[string]string, error) {
+	nonceBs := make([]byte, 16)
+	if _, err := rand.Read(nonceBs); err != nil {
+		return nil, err
+	}
+	nonce := hex.EncodeToString(nonceBs)
+	timestamp := strconv.FormatInt(s.now().UnixMilli(), 10)
+	return map[string]string{
+		MetaKeyID:     s.keyID,
+		MetaTimestamp: timestamp,
+		MetaNonce:     nonce,
+		MetaSignature: sign(s.secret, req, timestamp, nonce),
+	}, nil
+}
+
+// HMACKey 服务端保存的密钥以及该密钥对应的调用方
+type HMACKey struct {
+	Secret    []byte
+	Principal *Principal
+}
+
+type HMACOption func(a *HMACAuthenticator)
+
+// HMACWithMaxSkew 设置允许的时间偏差，超出的请求会被拒绝
+func HMACWithMaxSkew(skew time.Duration) HMACOption {
+	return func(a *HMACAuthenticator) {
+		a.maxSkew = skew
+	}
+}
+
+// HMACAuthenticator 校验签名，并通过时间戳和 nonce 防止重放
+type HMACAuthenticator struct {
+	keys    map[string]HMACKey
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mutex sync.Mutex
+	// nonces 记录时间窗口内出现过的 nonce 及其过期时间
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewHMACAuthenticator(keys map[string]HMACKey, opts ...HMACOption) *HMACAuthenticator {
+	res := &HMACAuthenticator{
+		keys:    keys,
+		maxSkew: 5 * time.Minute,
+		now:     time.Now,
+		nonces:  make(map[string]time.Time, 64),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (a *HMACAuthenticator) Authenticate(ctx context.Context, req *message.Request) (*Principal, error) {
+	keyID := req.Meta[MetaKeyID]
+	timestamp := req.Meta[MetaTimestamp]
+	nonce := req.Meta[MetaNonce]
+	signature := req.Meta[MetaSignature]
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return nil, errors.New("auth: 缺少签名信息")
+	}
+	key, ok := a.keys[keyID]
+	if !ok {
+		return nil, errors.New("auth: 未知的 key")
+	}
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("auth: 时间戳格式错误")
+	}
+	now := a.now()
+	signedAt := time.UnixMilli(ms)
+	if signedAt.Before(now.Add(-a.maxSkew)) || signedAt.After(now.Add(a.maxSkew)) {
+		return nil, errors.New("auth: 请求已过期")
+	}
+	expected := sign(key.Secret, req, timestamp, nonce)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, errors.New("auth: 签名错误")
+	}
+	// 签名校验通过后才记录 nonce，避免伪造请求占满缓存
+	if !a.useNonce(keyID+":"+nonce, signedAt.Add(a.maxSkew), now) {
+		return nil, errors.New("auth: 重复的请求")
+	}
+	return key.Principal, nil
+}
+
+// useNonce nonce 首次出现返回 true
+func (a *HMACAuthenticator) useNonce(nonce string, expireAt time.Time, now time.Time) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if now.Sub(a.lastSweep) > a.maxSkew {
+		for n, exp := range a.nonces {
+			if exp.Before(now) {
+				delete(a.nonces, n)
+			}
+		}
+		a.lastSweep = now
+	}
+	if _, ok := a.nonces[nonce]; ok {
+		return false
+	}
+	a.nonces[nonce] = expireAt
+	return true
+}
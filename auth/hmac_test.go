@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHMACAuthenticator_Authenticate(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	alice := &Principal{Name: "alice"}
+	newReq := func() *message.Request {
+		return &message.Request{
+			ServiceName: "user-service",
+			MethodName:  "GetById",
+			Meta:        map[string]string{},
+			Data:        []byte(`{"Id":123}`),
+		}
+	}
+	signReq := func(signer *HMACSigner, req *message.Request) *message.Request {
+		creds, err := signer.Credentials(context.Background(), req)
+		assert.NoError(t, err)
+		for k, v := range creds {
+			req.Meta[k] = v
+		}
+		return req
+	}
+	newSigner := func(keyID string, secret string, at time.Time) *HMACSigner {
+		s := NewHMACSigner(keyID, []byte(secret))
+		s.now = func() time.Time {
+			return at
+		}
+		return s
+	}
+	testCases := []struct {
+		name    string
+		req     func() *message.Request
+		wantRes *Principal
+		wantErr error
+	}{
+		{
+			name: "success",
+			req: func() *message.Request {
+				return signReq(newSigner("alice", "secret", now), newReq())
+			},
+			wantRes: alice,
+		},
+		{
+			name: "no signature",
+			req: func() *message.Request {
+				return newReq()
+			},
+			wantErr: errors.New("auth: 缺少签名信息"),
+		},
+		{
+			name: "unknown key",
+			req: func() *message.Request {
+				return signReq(newSigner("bob", "secret", now), newReq())
+			},
+			wantErr: errors.New("auth: 未知的 key"),
+		},
+		{
+			name: "wrong secret",
+			req: func() *message.Request {
+				return signReq(newSigner("alice", "wrong", now), newReq())
+			},
+			wantErr: errors.New("auth: 签名错误"),
+		},
+		{
+			name: "tampered data",
+			req: func() *message.Request {
+				req := signReq(newSigner("alice", "secret", now), newReq())
+				req.Data = []byte(`{"Id":456}`)
+				return req
+			},
+			wantErr: errors.New("auth: 签名错误"),
+		},
+		{
+			name: "tampered meta",
+			req: func() *message.Request {
+				req := newReq()
+				req.Meta["tenant"] = "a"
+				req = signReq(newSigner("alice", "secret", now), req)
+				req.Meta["tenant"] = "b"
+				return req
+			},
+			wantErr: errors.New("auth: 签名错误"),
+		},
+		{
+			name: "added meta",
+			req: func() *message.Request {
+				req := signReq(newSigner("alice", "secret", now), newReq())
+				req.Meta["one-way"] = "true"
+				return req
+			},
+			wantErr: errors.New("auth: 签名错误"),
+		},
+		{
+			name: "with meta",
+			req: func() *message.Request {
+				req := newReq()
+				req.Meta["tenant"] = "a"
+				req.Meta["deadline"] = "1700000001000"
+				return signReq(newSigner("alice", "secret", now), req)
+			},
+			wantRes: alice,
+		},
+		{
+			name: "expired",
+			req: func() *message.Request {
+				return signReq(newSigner("alice", "secret", now.Add(-time.Hour)), newReq())
+			},
+			wantErr: errors.New("auth: 请求已过期"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewHMACAuthenticator(map[string]HMACKey{
+				"alice": {Secret: []byte("secret"), Principal: alice},
+			})
+			a.now = func() time.Time {
+				return now
+			}
+			p, err := a.Authenticate(context.Background(), tc.req())
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRes, p)
+		})
+	}
+}
+
+func TestHMACAuthenticator_Replay(t *testing.T) {
+	a := NewHMACAuthenticator(map[string]HMACKey{
+		"alice": {Secret: []byte("secret"), Principal: &Principal{Name: "alice"}},
+	})
+	req := &message.Request{
+		ServiceName: "user-service",
+		MethodName:  "GetById",
+		Meta:        map[string]string{},
+	}
+	creds, err := NewHMACSigner("alice", []byte("secret")).Credentials(context.Background(), req)
+	assert.NoError(t, err)
+	req.Meta = creds
+	_, err = a.Authenticate(context.Background(), req)
+	assert.NoError(t, err)
+	_, err = a.Authenticate(context.Background(), req)
+	assert.Equal(t, errors.New("auth: 重复的请求"), err)
+}
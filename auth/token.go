@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/NotFound1911/mrpc/message"
+	"strings"
+)
+
+const (
+	MetaAuthorization = "authorization"
+	bearerPrefix      = "Bearer "
+)
+
+// StaticToken 客户端固定 token，以 Bearer 形式写入 Meta
+type StaticToken string
+
+func (t StaticToken) Credentials(ctx context.Context, req *message.Request) (map[string]string, error) {
+	return map[string]string{MetaAuthorization: bearerPrefix + string(t)}, nil
+}
+
+// StaticTokenAuthenticator 服务端根据预先配置的 token 识别调用方
+type StaticTokenAuthenticator struct {
+	tokens map[string]*Principal
+}
+
+// NewStaticTokenAuthenticator tokens 为 token 到调用方身份的映射
+func NewStaticTokenAuthenticator(tokens map[string]*Principal) *StaticTokenAuthenticator {
+	return &StaticTokenAuthenticator{
+		tokens: tokens,
+	}
+}
+
+func (a *StaticTokenAuthenticator) Authenticate(ctx context.Context, req *message.Request) (*Principal, error) {
+	val, ok := req.Meta[MetaAuthorization]
+	if !ok {
+		return nil, errors.New("auth: 缺少 token")
+	}
+	token, ok := strings.CutPrefix(val, bearerPrefix)
+	if !ok {
+		return nil, errors.New("auth: token 格式错误")
+	}
+	var res *Principal
+	// 逐个比较，避免通过耗时推断 token
+	for t, p := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			res = p
+		}
+	}
+	if res == nil {
+		return nil, errors.New("auth: 无效的 token")
+	}
+	return res, nil
+}
@@ -0,0 +1,352 @@
+package mrpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/serialize"
+	"github.com/NotFound1911/mrpc/status"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 批量调用复用普通的帧，服务名为 BatchServiceName
+// 请求体是多个完整的请求帧首尾相连，响应体是按相同顺序排列的响应帧
+const (
+	// BatchServiceName 批量调用的服务名
+	// 批量请求会先经过一次服务端拦截器，再由每一个子请求各自经过拦截器
+	BatchServiceName = "mrpc.batch"
+	batchMethodName  = "Do"
+	// maxBatchConcurrency 服务端并行处理一个批量请求的最大并发数
+	maxBatchConcurrency = 64
+)
+
+var (
+	errBatchFrame  = status.New(status.InvalidArgument, "批量请求格式错误")
+	errBatchNested = status.New(status.InvalidArgument, "批量请求不能嵌套")
+	// errBatchChecksum 与普通请求校验失败时的错误一致
+	errBatchChecksum = status.New(status.DataLoss, "请求校验和不匹配")
+)
+
+// Batch 批量调用，将多个请求合并为一帧发送
+type Batch struct {
+	c       *Client
+	ctx     context.Context
+	entries []*batchEntry
+	err     error
+}
+
+// batchEntry 批量调用中的一个请求
+// 与 InitService 生成的代理使用同样的方法配置：序列化协议、协商后的协议以及默认超时时间
+type batchEntry struct {
+	service string
+	method  string
+	req     any
+	setup   *methodSetup
+	// serializer 编码 sub 使用的序列化协议
+	serializer serialize.Serializer
+	sub        *message.Request
+}
+
+// encode 使用 sl 编码请求
+func (e *batchEntry) encode(sl serialize.Serializer) error {
+	data, err := sl.Encode(e.req)
+	if err != nil {
+		return err
+	}
+	e.serializer = sl
+	e.sub = &message.Request{
+		Version:     message.ProtocolVersion,
+		ServiceName: e.service,
+		MethodName:  e.method,
+		Serializer:  sl.Code(),
+		Meta:        map[string]string{},
+		Data:        data,
+	}
+	return nil
+}
+
+// BatchResult 批量调用中单个请求的结果
+type BatchResult struct {
+	// Err 服务端返回的错误
+	Err        error
+	resp       *message.Response
+	serializer serialize.Serializer
+}
+
+// Decode 将响应数据解析到 val 中
+func (r *BatchResult) Decode(val any) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if len(r.resp.Data) == 0 {
+		return nil
+	}
+	return r.serializer.Decode(r.resp.Data, val)
+}
+
+// Meta 服务端返回的元数据
+func (r *BatchResult) Meta() map[string]string {
+	return r.resp.Meta
+}
+
+// Batch 创建批量调用，ctx 中的元数据与超时时间作用于所有请求
+func (c *Client) Batch(ctx context.Context) *Batch {
+	return &Batch{c: c, ctx: ctx}
+}
+
+// Add 添加一个请求，method 为远程方法名
+// 方法通过 InitService 初始化过时使用其配置，例如 mrpc:"serializer=proto" 标签，否则使用客户端的默认配置
+func (b *Batch) Add(service, method string, req any) *Batch {
+	if b.err != nil {
+		return b
+	}
+	entry := &batchEntry{service: service, method: method, req: req, setup: b.c.methodSetup(service, method)}
+	if err := entry.encode(entry.setup.serializer()); err != nil {
+		b.err = err
+		return b
+	}
+	b.entries = append(b.entries, entry)
+	return b
+}
+
+// Do 发送所有请求，结果的顺序与添加的顺序一致
+// 返回的 error 表示整个批量调用失败，单个请求的错误保存在 BatchResult.Err 中
+// 服务端不支持请求使用的序列化协议时，与直接调用一样使用协商后的协议重新发送这些请求
+func (b *Batch) Do() ([]*BatchResult, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.entries) == 0 {
+		return nil, nil
+	}
+	res, err := b.do(b.entries)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		retries []*batchEntry
+		indexes []int
+	)
+	for i, result := range res {
+		fallback, ok := negotiateSerializer(result.resp, b.c.registry)
+		if !ok {
+			continue
+		}
+		entry := b.entries[i]
+		// 后续的调用直接使用协商后的协议
+		entry.setup.current.Store(&serializerBox{Serializer: fallback})
+		if err = entry.encode(fallback); err != nil {
+			result.Err = err
+			continue
+		}
+		retries = append(retries, entry)
+		indexes = append(indexes, i)
+	}
+	if len(retries) == 0 {
+		return res, nil
+	}
+	retried, err := b.do(retries)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range retried {
+		res[indexes[i]] = result
+	}
+	return res, nil
+}
+
+// do 将 entries 合并为一帧发送
+func (b *Batch) do(entries []*batchEntry) ([]*BatchResult, error) {
+	ctx := b.ctx
+	_, hasDeadline := ctx.Deadline()
+	// maxTimeout 调用方没有设置超时时间时，批量请求使用子请求中最长的默认超时时间
+	// 只要有一个子请求没有超时时间（unbounded），批量请求也没有
+	var (
+		maxTimeout time.Duration
+		unbounded  bool
+	)
+	now := time.Now()
+	frames := make([][]byte, 0, len(entries))
+	for i, entry := range entries {
+		sub := entry.sub
+		sub.RequestID = uint32(i + 1)
+		if b.c.checksum {
+			sub.Version |= message.FlagChecksum
+		}
+		if !hasDeadline {
+			timeout := entry.setup.timeout
+			if timeout > 0 {
+				// 子请求的超时时间随子请求发送，由服务端分别控制
+				sub.Meta[metaDeadline] = strconv.FormatInt(now.Add(timeout).UnixMilli(), 10)
+				maxTimeout = max(maxTimeout, timeout)
+			} else {
+				unbounded = true
+			}
+		}
+		sub.CalHeaderLen()
+		sub.CalBodyLen()
+		frames = append(frames, message.EncodeReq(sub))
+	}
+	if !hasDeadline && !unbounded {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxTimeout)
+		defer cancel()
+	}
+	meta, err := requestMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &message.Request{
+		ServiceName: BatchServiceName,
+		MethodName:  batchMethodName,
+		Serializer:  b.c.serializer.Code(),
+		Meta:        meta,
+		Data:        joinFrames(frames),
+	}
+	req.CalHeaderLen()
+	req.CalBodyLen()
+	resp, err := b.c.Invoke(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Error) > 0 {
+		return nil, respError(resp)
+	}
+	respFrames, err := splitFrames(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(respFrames) != len(entries) {
+		return nil, errors.New("mrpc: 批量响应数量与请求数量不一致")
+	}
+	res := make([]*BatchResult, 0, len(respFrames))
+	for i, frame := range respFrames {
+		if !message.ValidResp(frame) {
+			return nil, errBatchFrame
+		}
+		if !message.VerifyResp(frame) {
+			return nil, status.New(status.DataLoss, "响应校验和不匹配")
+		}
+		sub := message.DecodeResp(frame)
+		result := &BatchResult{resp: sub, serializer: entries[i].serializer}
+		if len(sub.Error) > 0 {
+			result.Err = respError(sub)
+		}
+		res = append(res, result)
+	}
+	return res, nil
+}
+
+func joinFrames(frames [][]byte) []byte {
+	size := 0
+	for _, frame := range frames {
+		size += len(frame)
+	}
+	res := make([]byte, 0, size)
+	for _, frame := range frames {
+		res = append(res, frame...)
+	}
+	return res
+}
+
+// splitFrames 按照每一帧开头的长度字段拆分
+func splitFrames(data []byte) ([][]byte, error) {
+	var res [][]byte
+	for len(data) > 0 {
+		if len(data) < numOfLengthBytes {
+			return nil, errBatchFrame
+		}
+		length := uint64(binary.BigEndian.Uint32(data[:4])) + uint64(binary.BigEndian.Uint32(data[4:8]))
+		if length < numOfLengthBytes || length > uint64(len(data)) {
+			return nil, errBatchFrame
+		}
+		res = append(res, data[:length])
+		data = data[length:]
+	}
+	return res, nil
+}
+
+type batchSubKey struct{}
+
+// IsBatchSub 当前请求是否为批量请求中的子请求
+// 该标记只由服务端写入，拦截器可以据此沿用批量请求已经完成的处理，例如认证
+func IsBatchSub(ctx context.Context) bool {
+	val, _ := ctx.Value(batchSubKey{}).(bool)
+	return val
+}
+
+// invokeBatch 并行处理批量请求中的每一个请求
+// 子请求的 context 来自批量请求，拦截器写入的信息（例如认证得到的调用方身份）对子请求可见
+// 批量请求的元数据会合并到每一个请求中，例如租户等业务元数据
+// 子请求自身的超时时间与校验和同普通请求一样生效
+func (s *Server) invokeBatch(ctx context.Context, req *message.Request) (*message.Response, error) {
+	resp := newResponse(req)
+	frames, err := splitFrames(req.Data)
+	if err != nil {
+		return resp, err
+	}
+	ctx = context.WithValue(ctx, batchSubKey{}, true)
+	results := make([][]byte, len(frames))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxBatchConcurrency)
+	for i, frame := range frames {
+		if !message.ValidReq(frame) {
+			sub := decodeFixedReq(frame)
+			if sub == nil {
+				sub = &message.Request{}
+			}
+			// 损坏的帧中的版本不可信，按照批量请求的版本回复
+			sub.Version = req.Version
+			results[i] = encodeSubResp(newResponse(sub), errBatchFrame)
+			continue
+		}
+		if !message.VerifyReq(frame) {
+			// 子请求带有校验和时单独校验
+			results[i] = encodeSubResp(newResponse(decodeFixedReq(frame)), errBatchChecksum)
+			continue
+		}
+		sub := message.DecodeReq(frame)
+		if sub.ServiceName == BatchServiceName {
+			// 嵌套的批量请求可以绕过 maxBatchConcurrency 的限制
+			results[i] = encodeSubResp(newResponse(sub), errBatchNested)
+			continue
+		}
+		meta := make(map[string]string, len(req.Meta)+len(sub.Meta))
+		for k, v := range req.Meta {
+			meta[k] = v
+		}
+		for k, v := range sub.Meta {
+			meta[k] = v
+		}
+		sub.Meta = meta
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, sub *message.Request) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			// 子请求可以有各自的超时时间
+			subCtx, cancel := ctxWithMetaDeadline(ctx, sub.Meta)
+			defer cancel()
+			subResp, err := s.Invoke(subCtx, sub)
+			results[i] = encodeSubResp(subResp, err)
+		}(i, sub)
+	}
+	wg.Wait()
+	resp.Data = joinFrames(results)
+	return resp, nil
+}
+
+func encodeSubResp(resp *message.Response, err error) []byte {
+	if err != nil {
+		resp.Status = uint8(status.CodeOf(err))
+		resp.Error = []byte(status.MessageOf(err))
+	}
+	resp.CalHeaderLength()
+	resp.CalBodyLength()
+	return message.EncodeResp(resp)
+}
@@ -0,0 +1,260 @@
+package mrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/NotFound1911/mrpc/internal/proto/gen"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/serialize/msgpack"
+	"github.com/NotFound1911/mrpc/serialize/proto"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// UserServiceServerBatch 根据 Id 返回结果，并记录最大并发数
+type UserServiceServerBatch struct {
+	running    atomic.Int32
+	maxRunning atomic.Int32
+}
+
+func (u *UserServiceServerBatch) Name() string {
+	return "user-service"
+}
+
+func (u *UserServiceServerBatch) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	running := u.running.Add(1)
+	defer u.running.Add(-1)
+	for {
+		old := u.maxRunning.Load()
+		if running <= old || u.maxRunning.CompareAndSwap(old, running) {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if req.Id == 0 {
+		return nil, status.New(status.InvalidArgument, "id 不能为空")
+	}
+	_ = SetTrailer(ctx, "id", fmt.Sprint(req.Id))
+	return &GetByIdResp{Msg: fmt.Sprintf("%s-%d", IncomingMeta(ctx)["tenant"], req.Id)}, nil
+}
+
+func TestBatch(t *testing.T) {
+	server := NewServer()
+	service := &UserServiceServerBatch{}
+	server.RegisterService(service)
+	go func() {
+		err := server.Start("tcp", ":8104")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+	client, err := NewClient(":8104")
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx = AppendOutgoingMeta(ctx, "tenant", "a")
+	results, err := client.Batch(ctx).
+		Add("user-service", "GetById", &GetByIdReq{Id: 1}).
+		Add("user-service", "GetById", &GetByIdReq{Id: 0}).
+		Add("user-service", "GetById", &GetByIdReq{Id: 3}).
+		Add("order-service", "GetById", &GetByIdReq{Id: 4}).
+		Do()
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	resp := &GetByIdResp{}
+	require.NoError(t, results[0].Decode(resp))
+	assert.Equal(t, "a-1", resp.Msg)
+	assert.Equal(t, "1", results[0].Meta()["id"])
+
+	assert.Equal(t, status.New(status.InvalidArgument, "id 不能为空"), results[1].Err)
+	assert.Equal(t, results[1].Err, results[1].Decode(resp))
+
+	resp = &GetByIdResp{}
+	require.NoError(t, results[2].Decode(resp))
+	assert.Equal(t, "a-3", resp.Msg)
+
+	assert.Equal(t, status.New(status.Unimplemented, "调用的服务不存在"), results[3].Err)
+	// 服务端并行处理
+	assert.Greater(t, service.maxRunning.Load(), int32(1))
+
+	// 空的批量调用不发送请求
+	results, err = client.Batch(ctx).Do()
+	assert.NoError(t, err)
+	assert.Nil(t, results)
+
+	// 编码失败
+	_, err = client.Batch(ctx).Add("user-service", "GetById", make(chan int)).Do()
+	assert.Error(t, err)
+}
+
+func TestBatchInvalidSub(t *testing.T) {
+	server := NewServer()
+	server.RegisterService(&UserServiceServerBatch{})
+	newReq := func(service string, data []byte) *message.Request {
+		req := &message.Request{
+			RequestID:   1,
+			Version:     message.ProtocolVersion,
+			ServiceName: service,
+			MethodName:  "GetById",
+			Serializer:  1,
+			Data:        data,
+		}
+		req.CalHeaderLen()
+		req.CalBodyLen()
+		return req
+	}
+	valid := message.EncodeReq(newReq("user-service", []byte(`{"Id":1}`)))
+	nested := message.EncodeReq(newReq(BatchServiceName, valid))
+	// 子请求的校验和不匹配
+	checksumReq := newReq("user-service", []byte(`{"Id":1}`))
+	checksumReq.Version |= message.FlagChecksum
+	checksumReq.CalHeaderLen()
+	corrupted := message.EncodeReq(checksumReq)
+	corrupted[len(corrupted)-2] ^= 0xff
+	// 头部长度只有 8，解析固定部分会越界
+	short := []byte{0, 0, 0, 8, 0, 0, 0, 0}
+	// 头部没有分隔符
+	noSeparator := make([]byte, 20)
+	noSeparator[3] = 20
+
+	req := newReq(BatchServiceName, joinFrames([][]byte{valid, short, noSeparator, nested, corrupted, valid}))
+	req.MethodName = batchMethodName
+	resp, err := server.Invoke(context.Background(), req)
+	require.NoError(t, err)
+	frames, err := splitFrames(resp.Data)
+	require.NoError(t, err)
+	require.Len(t, frames, 6)
+	wantCodes := []status.Code{status.OK, status.InvalidArgument, status.InvalidArgument, status.InvalidArgument,
+		status.DataLoss, status.OK}
+	for i, frame := range frames {
+		require.True(t, message.ValidResp(frame))
+		assert.Equal(t, wantCodes[i], status.ResultCode(message.DecodeResp(frame), nil), i)
+	}
+	assert.Equal(t, "批量请求不能嵌套", string(message.DecodeResp(frames[3]).Error))
+}
+
+// TestBatchMethodSetup 批量调用与直接调用使用同样的方法配置
+func TestBatchMethodSetup(t *testing.T) {
+	type call struct {
+		method     string
+		serializer uint8
+		deadline   bool
+	}
+	var (
+		mutex sync.Mutex
+		calls []call
+	)
+	server := NewServer(ServerWithInterceptors(func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			_, ok := ctx.Deadline()
+			mutex.Lock()
+			calls = append(calls, call{method: req.MethodName, serializer: req.Serializer, deadline: ok})
+			mutex.Unlock()
+			return next(ctx, req)
+		}
+	}))
+	server.RegisterService(&UserServiceServer{Msg: "hello"})
+	// 服务端不支持 msgpack
+	require.NoError(t, server.RegisterSerializer(&proto.Serializer{}))
+	go func() {
+		err := server.Start("tcp", ":8112")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+	client, err := NewClient(":8112", ClientWithSerializer(&msgpack.Serializer{}),
+		ClientWithMethodTimeout("user-service", "GetById", time.Second))
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+	takeCalls := func() []call {
+		mutex.Lock()
+		defer mutex.Unlock()
+		res := calls
+		calls = nil
+		return res
+	}
+
+	// GetById 使用 msgpack 失败后切换为 json，GetByIdProto 通过标签使用 proto
+	results, err := client.Batch(context.Background()).
+		Add("user-service", "GetById", &GetByIdReq{Id: 1}).
+		Add("user-service", "GetByIdProto", &gen.GetByIdReq{Id: 1}).
+		Do()
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	resp := &GetByIdResp{}
+	require.NoError(t, results[0].Decode(resp))
+	assert.Equal(t, "hello", resp.Msg)
+	protoResp := &gen.GetByIdResp{}
+	require.NoError(t, results[1].Decode(protoResp))
+	assert.Equal(t, "hello", protoResp.User.Name)
+	// GetById 有默认超时时间，GetByIdProto 没有，因此第一个批量请求没有超时时间
+	assert.ElementsMatch(t, []call{
+		{method: batchMethodName, serializer: 3},
+		{method: "GetById", serializer: 3, deadline: true},
+		{method: "GetByIdProto", serializer: 2},
+		{method: batchMethodName, serializer: 3, deadline: true},
+		{method: "GetById", serializer: 1, deadline: true},
+	}, takeCalls())
+
+	// 协商后的协议对之后的批量调用和直接调用都生效
+	results, err = client.Batch(context.Background()).Add("user-service", "GetById", &GetByIdReq{Id: 1}).Do()
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	_, err = usClient.GetById(context.Background(), &GetByIdReq{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []call{
+		{method: batchMethodName, serializer: 3, deadline: true},
+		{method: "GetById", serializer: 1, deadline: true},
+		{method: "GetById", serializer: 1, deadline: true},
+	}, takeCalls())
+}
+
+func TestSplitFrames(t *testing.T) {
+	testCases := []struct {
+		name string
+		data []byte
+
+		wantFrames [][]byte
+		wantErr    error
+	}{
+		{
+			name:       "two frames",
+			data:       []byte{0, 0, 0, 8, 0, 0, 0, 1, 'a', 0, 0, 0, 8, 0, 0, 0, 0},
+			wantFrames: [][]byte{{0, 0, 0, 8, 0, 0, 0, 1, 'a'}, {0, 0, 0, 8, 0, 0, 0, 0}},
+		},
+		{
+			name:    "short length",
+			data:    []byte{0, 0, 0, 8},
+			wantErr: errBatchFrame,
+		},
+		{
+			name:    "truncated",
+			data:    []byte{0, 0, 0, 8, 0, 0, 0, 10, 'a'},
+			wantErr: errBatchFrame,
+		},
+		{
+			name:    "zero length",
+			data:    []byte{0, 0, 0, 0, 0, 0, 0, 0},
+			wantErr: errBatchFrame,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			frames, err := splitFrames(tc.data)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantFrames, frames)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Package cache 客户端响应缓存
+//
+// 缓存的 key 由服务名、方法名、序列化协议、元数据与序列化后的请求组成
+// 元数据中的租户、token 以及 HMAC 的 key id 都会区分缓存，不同的调用方不会读到彼此的响应
+// 拦截器放在 auth.ClientInterceptor 之后才能看到凭证，之前时只能依靠请求自身携带的元数据区分调用方
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/auth"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetaMaxAge 服务端通过该元数据提示客户端缓存响应的时间，单位秒，为 0 表示不缓存
+const MetaMaxAge = "max-age"
+
+// SetMaxAge 服务端设置响应可以被缓存的时间，精度为秒
+func SetMaxAge(ctx context.Context, maxAge time.Duration) error {
+	return mrpc.SetTrailer(ctx, MetaMaxAge, strconv.FormatInt(int64(maxAge/time.Second), 10))
+}
+
+type noCacheKey struct{}
+
+// CtxWithNoCache 本次调用不读取也不写入缓存
+func CtxWithNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func isNoCache(ctx context.Context) bool {
+	val, _ := ctx.Value(noCacheKey{}).(bool)
+	return val
+}
+
+const defaultCapacity = 1024
+
+type config struct {
+	capacity int
+	// methods 开启缓存的方法与默认的缓存时间
+	methods map[string]time.Duration
+	// hints 是否接受服务端的 max-age 提示
+	hints bool
+	now   func() time.Time
+}
+
+type Option func(c *config)
+
+// WithCapacity 最多缓存的响应数量，超过时淘汰最久没有使用的响应，默认为 1024
+// capacity 小于等于 0 时使用默认值，关闭缓存应该不配置 WithMethod 或者使用 CtxWithNoCache
+func WithCapacity(capacity int) Option {
+	return func(c *config) {
+		c.capacity = capacity
+	}
+}
+
+// WithMethod 为方法开启缓存，ttl 为默认的缓存时间
+// 服务端返回 max-age 时以服务端为准
+func WithMethod(service, method string, ttl time.Duration) Option {
+	return func(c *config) {
+		c.methods[service+"."+method] = ttl
+	}
+}
+
+// WithServerHints 没有通过 WithMethod 开启缓存的方法，服务端返回 max-age 时也进行缓存
+func WithServerHints() Option {
+	return func(c *config) {
+		c.hints = true
+	}
+}
+
+// call 正在进行的调用，相同的请求等待其结果
+type call struct {
+	done chan struct{}
+	resp *message.Response
+	err  error
+}
+
+// Interceptor 返回客户端缓存拦截器
+// 只缓存成功的响应，相同的请求同时只会有一个发送到服务端
+func Interceptor(opts ...Option) mrpc.Interceptor {
+	cfg := &config{
+		capacity: defaultCapacity,
+		methods:  make(map[string]time.Duration, 4),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.capacity <= 0 {
+		cfg.capacity = defaultCapacity
+	}
+	cache := newLRU(cfg.capacity)
+	var (
+		mutex sync.Mutex
+		calls = make(map[string]*call, 16)
+	)
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			ttl, ok := cfg.methods[req.ServiceName+"."+req.MethodName]
+			if (!ok && !cfg.hints) || isNoCache(ctx) {
+				return next(ctx, req)
+			}
+			key := cacheKey(req)
+			if resp, ok := cache.get(key, cfg.now()); ok {
+				return cloneResponse(resp, req), nil
+			}
+
+			mutex.Lock()
+			if c, ok := calls[key]; ok {
+				mutex.Unlock()
+				select {
+				case <-c.done:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				// 发起调用的一方被取消时自己重新调用
+				if isCtxErr(c.err) {
+					return next(ctx, req)
+				}
+				if c.resp == nil {
+					return nil, c.err
+				}
+				return cloneResponse(c.resp, req), c.err
+			}
+			c := &call{done: make(chan struct{})}
+			calls[key] = c
+			mutex.Unlock()
+
+			c.resp, c.err = next(ctx, req)
+			if status.ResultCode(c.resp, c.err) == status.OK {
+				if maxAge, ok := maxAgeHint(c.resp); ok {
+					ttl = maxAge
+				}
+				if ttl > 0 {
+					cache.set(key, c.resp, cfg.now().Add(ttl))
+				}
+			}
+			mutex.Lock()
+			delete(calls, key)
+			mutex.Unlock()
+			close(c.done)
+			if c.resp == nil {
+				return nil, c.err
+			}
+			return cloneResponse(c.resp, req), c.err
+		}
+	}
+}
+
+// volatileMeta 每次请求都会变化的元数据，不参与计算缓存的 key
+// HMAC 签名的 key id 仍然参与，用于区分调用方
+var volatileMeta = map[string]struct{}{
+	auth.MetaTimestamp: {},
+	auth.MetaNonce:     {},
+	auth.MetaSignature: {},
+}
+
+func cacheKey(req *message.Request) string {
+	keys := make([]string, 0, len(req.Meta))
+	for k, v := range req.Meta {
+		if _, ok := volatileMeta[k]; ok {
+			continue
+		}
+		// 超时时间等框架保留的元数据不参与
+		if mrpc.CheckMeta(k, v) != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// 服务名、方法名与元数据中不会出现换行符
+	var sb strings.Builder
+	sb.WriteString(req.ServiceName + "\n" + req.MethodName + "\n" + strconv.Itoa(int(req.Serializer)) + "\n")
+	for _, k := range keys {
+		sb.WriteString(k + "\r" + req.Meta[k] + "\n")
+	}
+	sb.WriteString("\n")
+	sb.Write(req.Data)
+	return sb.String()
+}
+
+func maxAgeHint(resp *message.Response) (time.Duration, bool) {
+	val, ok := resp.Meta[MetaMaxAge]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func isCtxErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// cloneResponse 缓存的响应会被多次返回，复制一份避免调用方修改
+func cloneResponse(resp *message.Response, req *message.Request) *message.Response {
+	res := *resp
+	res.RequestID = req.RequestID
+	res.Meta = make(map[string]string, len(resp.Meta))
+	for k, v := range resp.Meta {
+		res.Meta[k] = v
+	}
+	res.Data = append([]byte(nil), resp.Data...)
+	res.Error = append([]byte(nil), resp.Error...)
+	return &res
+}
@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/NotFound1911/mrpc/auth"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// backend 模拟服务端，返回 resp 和 err，每次调用将请求数据回显在响应里
+type backend struct {
+	delay time.Duration
+	meta  map[string]string
+	code  status.Code
+	err   error
+	calls atomic.Int32
+}
+
+func (b *backend) handle(ctx context.Context, req *message.Request) (*message.Response, error) {
+	b.calls.Add(1)
+	select {
+	case <-time.After(b.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	resp := &message.Response{
+		RequestID: req.RequestID,
+		Status:    uint8(b.code),
+		Meta:      b.meta,
+		Data:      append([]byte(nil), req.Data...),
+	}
+	if b.code != status.OK {
+		resp.Error = []byte(b.code.String())
+	}
+	return resp, nil
+}
+
+func withNow(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	testCases := []struct {
+		name    string
+		backend *backend
+		opts    []Option
+		ctx     context.Context
+		// elapsed 两次调用之间经过的时间
+		elapsed time.Duration
+
+		wantErr   error
+		wantCalls int32
+	}{
+		{
+			name:      "not configured",
+			backend:   &backend{},
+			wantCalls: 2,
+		},
+		{
+			name:      "hit",
+			backend:   &backend{},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			elapsed:   time.Second,
+			wantCalls: 1,
+		},
+		{
+			name:      "expired",
+			backend:   &backend{},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			elapsed:   time.Minute,
+			wantCalls: 2,
+		},
+		{
+			name:      "no cache",
+			backend:   &backend{},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			ctx:       CtxWithNoCache(context.Background()),
+			wantCalls: 2,
+		},
+		{
+			name:      "error not cached",
+			backend:   &backend{code: status.NotFound},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			wantCalls: 2,
+		},
+		{
+			name:      "transport error not cached",
+			backend:   &backend{err: errors.New("connection refused")},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			wantErr:   errors.New("connection refused"),
+			wantCalls: 2,
+		},
+		{
+			name:      "server max-age overrides ttl",
+			backend:   &backend{meta: map[string]string{MetaMaxAge: "120"}},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			elapsed:   90 * time.Second,
+			wantCalls: 1,
+		},
+		{
+			name:      "server max-age zero",
+			backend:   &backend{meta: map[string]string{MetaMaxAge: "0"}},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			wantCalls: 2,
+		},
+		{
+			name:      "invalid max-age ignored",
+			backend:   &backend{meta: map[string]string{MetaMaxAge: "abc"}},
+			opts:      []Option{WithMethod("user-service", "GetById", time.Minute)},
+			wantCalls: 1,
+		},
+		{
+			name:      "server hints",
+			backend:   &backend{meta: map[string]string{MetaMaxAge: "60"}},
+			opts:      []Option{WithServerHints()},
+			wantCalls: 1,
+		},
+		{
+			name:      "server hints without max-age",
+			backend:   &backend{},
+			opts:      []Option{WithServerHints()},
+			wantCalls: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			opts := append(tc.opts, withNow(func() time.Time { return now }))
+			handler := Interceptor(opts...)(tc.backend.handle)
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			for i := 0; i < 2; i++ {
+				req := &message.Request{
+					RequestID:   uint32(i + 1),
+					ServiceName: "user-service",
+					MethodName:  "GetById",
+					Data:        []byte(`{"id":1}`),
+				}
+				resp, err := handler(ctx, req)
+				assert.Equal(t, tc.wantErr, err)
+				if err == nil {
+					assert.Equal(t, req.RequestID, resp.RequestID)
+					assert.Equal(t, []byte(`{"id":1}`), resp.Data)
+				}
+				now = now.Add(tc.elapsed)
+			}
+			assert.Equal(t, tc.wantCalls, tc.backend.calls.Load())
+		})
+	}
+}
+
+func TestInterceptor_Key(t *testing.T) {
+	b := &backend{}
+	handler := Interceptor(
+		WithMethod("user-service", "GetById", time.Minute),
+		WithMethod("user-service", "List", time.Minute),
+	)(b.handle)
+	reqs := []*message.Request{
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1")},
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("2")},
+		{ServiceName: "user-service", MethodName: "GetById", Serializer: 2, Data: []byte("1")},
+		{ServiceName: "user-service", MethodName: "List", Data: []byte("1")},
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"), Meta: map[string]string{"tenant": "a"}},
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"), Meta: map[string]string{"tenant": "b"}},
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"),
+			Meta: map[string]string{auth.MetaAuthorization: "Bearer a"}},
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"),
+			Meta: map[string]string{auth.MetaAuthorization: "Bearer b"}},
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"),
+			Meta: map[string]string{auth.MetaKeyID: "a", auth.MetaNonce: "1", auth.MetaSignature: "1"}},
+		{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"),
+			Meta: map[string]string{auth.MetaKeyID: "b", auth.MetaNonce: "1", auth.MetaSignature: "1"}},
+	}
+	for i := 0; i < 2; i++ {
+		for _, req := range reqs {
+			resp, err := handler(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, req.Data, resp.Data)
+		}
+	}
+	assert.Equal(t, int32(len(reqs)), b.calls.Load())
+
+	// 每次请求都会变化的签名与超时时间不影响命中
+	resp, err := handler(context.Background(), &message.Request{
+		ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"),
+		Meta: map[string]string{auth.MetaKeyID: "a", auth.MetaNonce: "2", auth.MetaSignature: "2", "deadline": "1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), resp.Data)
+	assert.Equal(t, int32(len(reqs)), b.calls.Load())
+}
+
+func TestInterceptor_Evict(t *testing.T) {
+	b := &backend{}
+	handler := Interceptor(WithCapacity(2), WithMethod("user-service", "GetById", time.Minute))(b.handle)
+	call := func(data string) {
+		_, err := handler(context.Background(), &message.Request{
+			ServiceName: "user-service", MethodName: "GetById", Data: []byte(data),
+		})
+		require.NoError(t, err)
+	}
+	call("1")
+	call("2")
+	// 访问 1 之后，2 成为最久没有使用的响应
+	call("1")
+	call("3")
+	assert.Equal(t, int32(3), b.calls.Load())
+	call("1")
+	call("3")
+	assert.Equal(t, int32(3), b.calls.Load())
+	call("2")
+	assert.Equal(t, int32(4), b.calls.Load())
+}
+
+func TestInterceptor_InvalidCapacity(t *testing.T) {
+	for _, capacity := range []int{0, -1} {
+		b := &backend{}
+		handler := Interceptor(WithCapacity(capacity), WithMethod("user-service", "GetById", time.Minute))(b.handle)
+		for i := 0; i < 2; i++ {
+			_, err := handler(context.Background(), &message.Request{
+				ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"),
+			})
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int32(1), b.calls.Load(), "capacity %d", capacity)
+	}
+}
+
+func TestInterceptor_SingleFlight(t *testing.T) {
+	b := &backend{delay: 100 * time.Millisecond}
+	handler := Interceptor(WithMethod("user-service", "GetById", time.Minute))(b.handle)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := handler(context.Background(), &message.Request{
+				RequestID: uint32(i), ServiceName: "user-service", MethodName: "GetById", Data: []byte("1"),
+			})
+			require.NoError(t, err)
+			assert.Equal(t, uint32(i), resp.RequestID)
+			assert.Equal(t, []byte("1"), resp.Data)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), b.calls.Load())
+}
+
+func TestInterceptor_LeaderCanceled(t *testing.T) {
+	b := &backend{delay: 100 * time.Millisecond}
+	handler := Interceptor(WithMethod("user-service", "GetById", time.Minute))(b.handle)
+	req := &message.Request{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := handler(ctx, req)
+		leaderErr <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	// 发起调用的一方超时，等待的一方重新发起调用
+	resp, err := handler(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), resp.Data)
+	assert.Equal(t, context.DeadlineExceeded, <-leaderErr)
+	assert.Equal(t, int32(2), b.calls.Load())
+}
+
+func TestInterceptor_Clone(t *testing.T) {
+	b := &backend{meta: map[string]string{"k": "v"}}
+	handler := Interceptor(WithMethod("user-service", "GetById", time.Minute))(b.handle)
+	req := &message.Request{ServiceName: "user-service", MethodName: "GetById", Data: []byte("1")}
+	resp, err := handler(context.Background(), req)
+	require.NoError(t, err)
+	resp.Meta["k"] = "modified"
+	resp.Data[0] = '2'
+
+	resp, err = handler(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"k": "v"}, resp.Meta)
+	assert.Equal(t, []byte("1"), resp.Data)
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/NotFound1911/mrpc/message"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key      string
+	resp     *message.Response
+	expireAt time.Time
+}
+
+// lru 带过期时间的 LRU 缓存
+type lru struct {
+	mutex    sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+func (c *lru) get(key string, now time.Time) (*message.Response, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !now.Before(e.expireAt) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return e.resp, true
+}
+
+func (c *lru) set(key string, resp *message.Response, expireAt time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry)
+		e.resp, e.expireAt = resp, expireAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, resp: resp, expireAt: expireAt})
+	for c.ll.Len() > c.capacity {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *lru) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ll.Len()
+}
+
+// remove 调用方需要持有锁
+func (c *lru) remove(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*entry).key)
+}
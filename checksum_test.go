@@ -0,0 +1,120 @@
+package mrpc
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestChecksum(t *testing.T) {
+	server := NewServer()
+	server.RegisterService(&UserServiceServer{Msg: "hello"})
+	go func() {
+		err := server.Start("tcp", ":8106")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	// 服务端为带有校验和的请求返回带有校验和的响应
+	var version uint8
+	client, err := NewClient(":8106", ClientWithChecksum(), ClientWithInterceptors(
+		func(next HandleFunc) HandleFunc {
+			return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+				resp, err := next(ctx, req)
+				if resp != nil {
+					version = resp.Version
+				}
+				return resp, err
+			}
+		}))
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+	resp, err := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Msg)
+	assert.Equal(t, message.FlagChecksum, version&message.FlagChecksum)
+
+	// 请求在传输中损坏
+	conn, err := net.Dial("tcp", ":8106")
+	require.NoError(t, err)
+	defer conn.Close()
+	newReq := func() []byte {
+		req := &message.Request{
+			RequestID:   1,
+			Version:     message.ProtocolVersion | message.FlagChecksum,
+			Serializer:  1,
+			ServiceName: "user-service",
+			MethodName:  "GetById",
+			Data:        []byte(`{"Id":123}`),
+		}
+		req.CalHeaderLen()
+		req.CalBodyLen()
+		return message.EncodeReq(req)
+	}
+	data := newReq()
+	data[len(data)-3] ^= 0xff
+	_, err = conn.Write(data)
+	require.NoError(t, err)
+	respBs, err := ReadMsg(conn)
+	require.NoError(t, err)
+	assert.True(t, message.VerifyResp(respBs))
+	assert.Equal(t, status.DataLoss, status.ResultCode(message.DecodeResp(respBs), nil))
+	// 帧的长度没有损坏，连接仍然可以使用
+	_, err = conn.Write(newReq())
+	require.NoError(t, err)
+	respBs, err = ReadMsg(conn)
+	require.NoError(t, err)
+	assert.Equal(t, status.OK, status.ResultCode(message.DecodeResp(respBs), nil))
+}
+
+func TestChecksumCorruptedResp(t *testing.T) {
+	// 模拟会损坏响应的服务端
+	listener, err := net.Listen("tcp", ":8107")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					reqBs, err := ReadMsg(conn)
+					if err != nil {
+						return
+					}
+					resp := newResponse(message.DecodeReq(reqBs))
+					resp.Data = []byte(`{"Msg":"hello"}`)
+					resp.CalHeaderLength()
+					resp.CalBodyLength()
+					data := message.EncodeResp(resp)
+					data[len(data)-3] ^= 0xff
+					if _, err = conn.Write(data); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	client, err := NewClient(":8107", ClientWithChecksum())
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = usClient.GetById(ctx, &GetByIdReq{Id: 123})
+	assert.Equal(t, status.DataLoss, status.CodeOf(err))
+	// 校验失败的连接不再复用
+	assert.Equal(t, int64(1), client.PoolStats().Broken)
+}
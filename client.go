@@ -3,23 +3,139 @@ package mrpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/pool"
 	"github.com/NotFound1911/mrpc/serialize"
 	"github.com/NotFound1911/mrpc/serialize/json"
-	"github.com/silenceper/pool"
-	"net"
+	"github.com/NotFound1911/mrpc/serialize/proto"
+	"github.com/NotFound1911/mrpc/status"
+	"os"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const numOfLengthBytes = 8
 
 // InitService 为GetById之类的函数类型字段赋值
+// 字段必须是 func(context.Context, *Req) (*Resp, error) 类型，所有字段校验通过后才会赋值
+// 字段可以通过 mrpc:"serializer=proto" 标签指定客户端中注册的其他序列化协议
+// 通过 mrpc:"name=GetById" 指定远程方法名，通过 mrpc:"-" 跳过字段
+// 通过 mrpc:"timeout=200ms" 指定调用方没有设置超时时间时使用的超时时间
 func (c *Client) InitService(service Service) error {
-	return setFuncField(service, c, c.serializer)
+	return setFuncField(service, c, c.serializer, c.registry, c.timeouts, &c.methods)
 }
-func setFuncField(service Service, p Proxy, s serialize.Serializer) error {
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// funcField 校验通过的函数字段
+type funcField struct {
+	typ        reflect.StructField
+	val        reflect.Value
+	methodName string
+	serializer serialize.Serializer
+	// timeout 标签中指定的超时时间
+	timeout time.Duration
+}
+
+// checkFuncType 校验字段是否为 func(context.Context, *Req) (*Resp, error)
+func checkFuncType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Func && !typ.IsVariadic() &&
+		typ.NumIn() == 2 && typ.In(0) == contextType && typ.In(1).Kind() == reflect.Pointer &&
+		typ.NumOut() == 2 && typ.Out(0).Kind() == reflect.Pointer && typ.Out(1) == errorType
+}
+
+// funcFields 校验所有字段，返回需要赋值的字段
+// 校验失败时返回所有字段的错误
+func funcFields(val reflect.Value, defSerializer serialize.Serializer, registry *serialize.Registry) ([]funcField, error) {
+	typ := val.Type()
+	numField := typ.NumField()
+	res := make([]funcField, 0, numField)
+	var errs []error
+	for i := 0; i < numField; i++ {
+		fieldTyp := typ.Field(i)
+		fieldVal := val.Field(i)
+		if !fieldVal.CanSet() {
+			continue
+		}
+		tag := parseTag(fieldTyp.Tag.Get(tagName))
+		if _, ok := tag["-"]; ok {
+			continue
+		}
+		if fieldTyp.Type.Kind() != reflect.Func {
+			errs = append(errs, fmt.Errorf("mrpc: 字段 %s 的类型 %s 不是函数", fieldTyp.Name, fieldTyp.Type))
+			continue
+		}
+		if !checkFuncType(fieldTyp.Type) {
+			errs = append(errs, fmt.Errorf("mrpc: 字段 %s 的类型 %s 不是 func(context.Context, *Req) (*Resp, error)",
+				fieldTyp.Name, fieldTyp.Type))
+			continue
+		}
+		field := funcField{
+			typ:        fieldTyp,
+			val:        fieldVal,
+			methodName: fieldTyp.Name,
+			serializer: defSerializer,
+		}
+		if name, ok := tag["name"]; ok {
+			if name == "" {
+				errs = append(errs, fmt.Errorf("mrpc: 字段 %s 的远程方法名不能为空", fieldTyp.Name))
+				continue
+			}
+			field.methodName = name
+		}
+		if val, ok := tag["timeout"]; ok {
+			timeout, err := time.ParseDuration(val)
+			if err != nil || timeout <= 0 {
+				errs = append(errs, fmt.Errorf("mrpc: 字段 %s 的超时时间 %s 不合法", fieldTyp.Name, val))
+				continue
+			}
+			field.timeout = timeout
+		}
+		if name, ok := tag["serializer"]; ok {
+			found := false
+			if registry != nil {
+				field.serializer, found = registry.ByName(name)
+			}
+			if !found {
+				errs = append(errs, fmt.Errorf("mrpc: 字段 %s 使用了未注册的序列化协议 %s", fieldTyp.Name, name))
+				continue
+			}
+		}
+		res = append(res, field)
+	}
+	return res, errors.Join(errs...)
+}
+
+// methodSetup 方法的调用配置，InitService 生成的代理与批量调用共用
+type methodSetup struct {
+	// current 当前使用的序列化协议，服务端不支持时切换为协商后的协议
+	current atomic.Pointer[serializerBox]
+	// timeout 调用方没有设置超时时间时使用的超时时间
+	timeout time.Duration
+}
+
+func newMethodSetup(sl serialize.Serializer, timeout time.Duration) *methodSetup {
+	res := &methodSetup{timeout: timeout}
+	res.current.Store(&serializerBox{Serializer: sl})
+	return res
+}
+
+func (m *methodSetup) serializer() serialize.Serializer {
+	return m.current.Load().Serializer
+}
+
+// setFuncField 为服务的函数字段赋值
+// methods 不为 nil 时按照 service.method 保存每个方法的调用配置
+func setFuncField(service Service, p Proxy, defSerializer serialize.Serializer,
+	registry *serialize.Registry, timeouts timeoutConfig, methods *sync.Map) error {
 	if service == nil {
 		return errors.New("mrpc: 不支持nil")
 	}
@@ -28,56 +144,90 @@ func setFuncField(service Service, p Proxy, s serialize.Serializer) error {
 	if typ.Kind() != reflect.Pointer || typ.Elem().Kind() != reflect.Struct {
 		return errors.New("mrpc: 只支持指向结构体的一级指针")
 	}
-	// 获取指针指向的实际数值和类型
-	val = val.Elem()
-	typ = typ.Elem()
-
-	numField := typ.NumField()
-	// numField 为Proxy方法数量
-	for i := 0; i < numField; i++ {
-		// 获取字段的类型和值
-		fieldTyp := typ.Field(i)
-		fieldVal := val.Field(i)
-
-		if !fieldVal.CanSet() {
-			continue
+	fields, err := funcFields(val.Elem(), defSerializer, registry)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		fieldTyp := field.typ
+		methodName := field.methodName
+		setup := newMethodSetup(field.serializer, timeouts.get(service.Name(), methodName, field.timeout))
+		if methods != nil {
+			methods.Store(service.Name()+"."+methodName, setup)
 		}
+		timeout := setup.timeout
 		// 本地调用捕捉到的地方
 		fn := func(args []reflect.Value) (results []reflect.Value) {
 			ctx := args[0].Interface().(context.Context)
+			if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
 			// retVal 是一个指向输出参数类型的新指针，用于存储远程调用的结果
 			retVal := reflect.New(fieldTyp.Type.Out(0).Elem())
-			// 将请求数据序列化为
-			reqData, err := s.Encode(args[1].Interface())
+			s := setup.serializer()
+			ctx, payload := ctxWithPayload(ctx)
+			payload.req = args[1].Interface()
+			payload.decodeResp = func(data []byte) (any, error) {
+				val := reflect.New(fieldTyp.Type.Out(0).Elem()).Interface()
+				return val, s.Decode(data, val)
+			}
+			meta, err := requestMeta(ctx)
 			if err != nil {
 				return []reflect.Value{retVal, reflect.ValueOf(err)}
 			}
-			meta := make(map[string]string, 2)
-			if deadline, ok := ctx.Deadline(); ok {
-				meta["deadline"] = strconv.FormatInt(deadline.UnixMilli(), 10)
-			}
-			if isOneway(ctx) {
-				meta = map[string]string{"one-way": "true"}
-			}
 			// 创建Request对象
 			// 根据函数字段构建请求
-			req := &message.Request{
-				ServiceName: service.Name(),
-				MethodName:  fieldTyp.Name,
-				Data:        reqData,
-				Serializer:  s.Code(),
-				Meta:        meta,
-			}
-			req.CalHeaderLen()
-			req.CalBodyLen()
+			newReq := func(s serialize.Serializer) (*message.Request, error) {
+				// 将请求数据序列化为
+				reqData, err := s.Encode(args[1].Interface())
+				if err != nil {
+					return nil, err
+				}
+				reqMeta := make(map[string]string, len(meta))
+				for k, v := range meta {
+					reqMeta[k] = v
+				}
+				req := &message.Request{
+					ServiceName: service.Name(),
+					MethodName:  methodName,
+					Data:        reqData,
+					Serializer:  s.Code(),
+					Meta:        reqMeta,
+				}
+				req.CalHeaderLen()
+				req.CalBodyLen()
+				return req, nil
+			}
+			req, err := newReq(s)
+			if err != nil {
+				return []reflect.Value{retVal, reflect.ValueOf(err)}
+			}
 			// 发起调用，调用代理对象的Invoke方法
 			resp, err := p.Invoke(ctx, req)
+			if err == nil {
+				if fallback, ok := negotiateSerializer(resp, registry); ok {
+					// 服务端不支持当前协议，使用协商后的协议重试，后续调用直接使用该协议
+					setup.current.Store(&serializerBox{Serializer: fallback})
+					s = fallback
+					if req, err = newReq(s); err != nil {
+						return []reflect.Value{retVal, reflect.ValueOf(err)}
+					}
+					resp, err = p.Invoke(ctx, req)
+				}
+			}
 			if err != nil {
 				return []reflect.Value{retVal, reflect.ValueOf(err)}
 			}
+			if receiver := trailerReceiver(ctx); receiver != nil {
+				for k, v := range resp.Meta {
+					receiver[k] = v
+				}
+			}
 			var retErr error
 			if len(resp.Error) > 0 {
-				retErr = errors.New(string(resp.Error))
+				retErr = respError(resp)
 			}
 			if len(resp.Data) > 0 {
 				// 将响应数据解析为目标结构体并赋值给retVal
@@ -98,55 +248,243 @@ func setFuncField(service Service, p Proxy, s serialize.Serializer) error {
 		// 使用反射创建一个函数值
 		fnVal := reflect.MakeFunc(fieldTyp.Type, fn)
 		// 设置字段的值为创建的函数值
-		fieldVal.Set(fnVal)
+		field.val.Set(fnVal)
 	}
 	return nil
 }
 
+// serializerBox 用于原子地替换序列化协议
+type serializerBox struct {
+	serialize.Serializer
+}
+
+// negotiateSerializer 服务端不支持请求使用的序列化协议时
+// 按服务端声明的顺序选择客户端也支持的协议
+func negotiateSerializer(resp *message.Response, registry *serialize.Registry) (serialize.Serializer, bool) {
+	if registry == nil || status.Code(resp.Status) != status.Unimplemented {
+		return nil, false
+	}
+	names, ok := resp.Meta[metaSerializers]
+	if !ok {
+		return nil, false
+	}
+	for _, name := range strings.Split(names, ",") {
+		if sl, ok := registry.ByName(name); ok {
+			return sl, true
+		}
+	}
+	return nil, false
+}
+
+// respError 将响应中的错误还原为 error
+// 未携带明确状态码的错误还原为普通 error
+func respError(resp *message.Response) error {
+	code := status.Code(resp.Status)
+	if code == status.OK || code == status.Unknown {
+		return errors.New(string(resp.Error))
+	}
+	return status.New(code, string(resp.Error))
+}
+
 type Client struct {
-	pool       pool.Pool
-	serializer serialize.Serializer
+	addr         string
+	pool         *pool.Pool
+	poolConfig   pool.Config
+	requestID    atomic.Uint32
+	serializer   serialize.Serializer
+	serializers  []serialize.Serializer
+	registry     *serialize.Registry
+	interceptors []Interceptor
+	handler      HandleFunc
+	healthCheck  bool
+	health       *healthWatcher
+	timeouts     timeoutConfig
+	// methods service.method 对应的 *methodSetup
+	methods  sync.Map
+	limits   msgLimits
+	checksum bool
 }
 type ClientOption func(client *Client)
 
+// ClientWithSerializer 设置默认的序列化协议
 func ClientWithSerializer(sl serialize.Serializer) ClientOption {
 	return func(client *Client) {
 		client.serializer = sl
+		client.serializers = append(client.serializers, sl)
 	}
 }
-func NewClient(addr string, opts ...ClientOption) (*Client, error) {
-	p, err := pool.NewChannelPool(&pool.Config{
-		InitialCap:  5,
-		MaxCap:      30,
-		MaxIdle:     10,
-		IdleTimeout: time.Minute,
-		Factory: func() (interface{}, error) {
-			return net.DialTimeout("tcp", addr, time.Second*3)
-		},
-		Close: func(i interface{}) error {
-			return i.(net.Conn).Close()
-		},
-	})
-	if err != nil {
-		return nil, err
+
+// ClientWithSerializers 注册额外的序列化协议，供服务字段通过标签选择
+// json 与 proto 默认已经注册
+func ClientWithSerializers(sls ...serialize.Serializer) ClientOption {
+	return func(client *Client) {
+		client.serializers = append(client.serializers, sls...)
+	}
+}
+
+// ClientWithTimeout 调用方没有设置超时时间时使用的默认超时时间
+// 超时时间同样限制连接上的读写，服务端一直不响应时连接会被丢弃并归还连接池
+func ClientWithTimeout(timeout time.Duration) ClientOption {
+	return func(client *Client) {
+		client.timeouts.def = timeout
+	}
+}
+
+// ClientWithServiceTimeout 为服务设置默认超时时间，优先于 ClientWithTimeout
+func ClientWithServiceTimeout(service string, timeout time.Duration) ClientOption {
+	return func(client *Client) {
+		if client.timeouts.services == nil {
+			client.timeouts.services = make(map[string]time.Duration, 4)
+		}
+		client.timeouts.services[service] = timeout
+	}
+}
+
+// ClientWithMethodTimeout 为方法设置默认超时时间，优先级最高
+// method 为远程方法名
+func ClientWithMethodTimeout(service, method string, timeout time.Duration) ClientOption {
+	return func(client *Client) {
+		if client.timeouts.methods == nil {
+			client.timeouts.methods = make(map[string]time.Duration, 4)
+		}
+		client.timeouts.methods[service+"."+method] = timeout
+	}
+}
+
+// timeoutConfig 默认超时时间
+// 优先级为 ClientWithMethodTimeout、timeout 标签、ClientWithServiceTimeout、ClientWithTimeout
+type timeoutConfig struct {
+	def      time.Duration
+	services map[string]time.Duration
+	methods  map[string]time.Duration
+}
+
+func (t timeoutConfig) get(service, method string, tagTimeout time.Duration) time.Duration {
+	if timeout, ok := t.methods[service+"."+method]; ok {
+		return timeout
+	}
+	if tagTimeout > 0 {
+		return tagTimeout
+	}
+	if timeout, ok := t.services[service]; ok {
+		return timeout
+	}
+	return t.def
+}
+
+// ClientWithMaxRecvSize 设置能够接收的最大响应，默认为 DefaultMaxRecvSize，为 0 表示不限制
+// 超过限制时调用返回 ResourceExhausted
+func ClientWithMaxRecvSize(size int) ClientOption {
+	return func(client *Client) {
+		client.limits.maxRecv = size
+	}
+}
+
+// ClientWithMaxSendSize 设置能够发送的最大请求，默认不限制
+// 超过限制时请求不会发送，调用返回 ResourceExhausted
+func ClientWithMaxSendSize(size int) ClientOption {
+	return func(client *Client) {
+		client.limits.maxSend = size
+	}
+}
+
+// ClientWithChunkSize 超过 size 的请求拆分成多个分块帧发送，服务端会还原成完整的请求
+// 分块只改变传输方式，两端仍然在内存中持有完整的请求，大小仍然受 ClientWithMaxSendSize 和 ServerWithMaxRecvSize 限制
+// 默认不分块
+func ClientWithChunkSize(size int) ClientOption {
+	return func(client *Client) {
+		client.limits.chunkSize = size
+	}
+}
+
+// ClientWithChecksum 请求带上 CRC32C 校验和，服务端会为响应同样计算校验和
+// 任何一端校验失败时调用返回 DataLoss
+func ClientWithChecksum() ClientOption {
+	return func(client *Client) {
+		client.checksum = true
+	}
+}
+
+// ClientWithPoolConfig 设置连接池，默认使用 pool.DefaultConfig
+func ClientWithPoolConfig(cfg pool.Config) ClientOption {
+	return func(client *Client) {
+		client.poolConfig = cfg
+	}
+}
+
+// ClientWithInterceptors 设置客户端拦截器
+func ClientWithInterceptors(interceptors ...Interceptor) ClientOption {
+	return func(client *Client) {
+		client.interceptors = append(client.interceptors, interceptors...)
 	}
+}
+func NewClient(addr string, opts ...ClientOption) (*Client, error) {
 	res := &Client{
-		pool:       p,
+		addr:       addr,
 		serializer: &json.Serializer{},
+		poolConfig: pool.DefaultConfig(),
+		limits:     defaultMsgLimits(),
 	}
 	for _, opt := range opts {
 		opt(res)
 	}
+	// 默认注册 json 与 proto
+	registry, err := serialize.NewRegistry(append([]serialize.Serializer{
+		&json.Serializer{}, &proto.Serializer{},
+	}, res.serializers...)...)
+	if err != nil {
+		return nil, err
+	}
+	res.registry = registry
+	// 连接在第一次调用或者后台预热时建立，服务端暂时不可用不影响创建客户端
+	res.pool = pool.New(addr, res.poolConfig)
+	res.handler = chainInterceptors(res.invoke, res.interceptors)
+	if res.healthCheck {
+		if err = res.watchHealth(); err != nil {
+			_ = res.pool.Close()
+			return nil, err
+		}
+	}
 	return res, nil
 }
+
+// Close 关闭客户端，释放所有连接
+func (c *Client) Close() error {
+	if c.health != nil {
+		c.health.cancel()
+	}
+	return c.pool.Close()
+}
 func (c *Client) Invoke(ctx context.Context, req *message.Request) (*message.Response, error) {
+	if req.RequestID == 0 {
+		req.RequestID = c.requestID.Add(1)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		// 直接调用 Invoke 的请求（例如网关）同样使用默认超时时间，并告知服务端
+		if timeout := c.timeouts.get(req.ServiceName, req.MethodName, 0); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+			deadline, _ := ctx.Deadline()
+			if req.Meta == nil {
+				req.Meta = make(map[string]string, 1)
+			}
+			req.Meta[metaDeadline] = strconv.FormatInt(deadline.UnixMilli(), 10)
+		}
+	}
+	return c.handler(ctxWithPeer(ctx, c.addr), req)
+}
+func (c *Client) invoke(ctx context.Context, req *message.Request) (*message.Response, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
-	ch := make(chan struct{})
-	defer func() {
-		close(ch)
-	}()
+	if req.ServiceName != HealthServiceName {
+		if err := c.health.checkHealth(); err != nil {
+			return nil, err
+		}
+	}
+	// 超时返回后 goroutine 仍会写入，需要缓冲避免阻塞
+	ch := make(chan struct{}, 1)
 	var (
 		resp *message.Response
 		err  error
@@ -163,7 +501,18 @@ func (c *Client) Invoke(ctx context.Context, req *message.Request) (*message.Res
 	}
 }
 func (c *Client) doInvoke(ctx context.Context, req *message.Request) (*message.Response, error) {
+	// 服务端按照请求的版本编码响应
+	req.Version = message.ProtocolVersion
+	if c.checksum {
+		req.Version |= message.FlagChecksum
+	}
+	// 拦截器可能修改了 Meta 或 Data，需要重新计算长度
+	req.CalHeaderLen()
+	req.CalBodyLen()
 	data := message.EncodeReq(req)
+	if err := c.limits.checkSend(len(data)); err != nil {
+		return nil, err
+	}
 	resp, err := c.send(ctx, data) // 请求发送到服务端
 	if err != nil {
 		return nil, err
@@ -171,20 +520,73 @@ func (c *Client) doInvoke(ctx context.Context, req *message.Request) (*message.R
 	return message.DecodeResp(resp), nil
 }
 func (c *Client) send(ctx context.Context, data []byte) ([]byte, error) {
-	val, err := c.pool.Get()
+	conn, err := c.pool.Get(ctx)
 	if err != nil {
 		return nil, err
 	}
-	conn := val.(net.Conn)
-	defer func() {
-		c.pool.Put(val)
-	}()
-	_, err = conn.Write(data)
-	if err != nil {
+	// 读写都受 ctx 控制，超时或者取消之后连接上的 I/O 立刻失败，连接被丢弃而不是一直占用
+	// 连接可能带着上一次调用的 deadline，需要重新设置
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		c.pool.Put(conn, err)
 		return nil, err
 	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	// put 归还连接，ctx 结束时连接的 deadline 已经被修改，不能再复用
+	put := func(err error) error {
+		if !stop() && err == nil {
+			err = ctx.Err()
+		}
+		c.pool.Put(conn, err)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// 连接的 deadline 只来自 ctx，连接可能比 ctx 先一步超时
+			<-ctx.Done()
+		}
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if err = writeMsg(conn, data, c.limits.chunkSize); err != nil {
+		// 写了一半的连接不能再使用
+		return nil, put(err)
+	}
 	if isOneway(ctx) {
+		// 服务端不会响应 oneway 调用，连接可以直接复用
+		_ = put(nil)
 		return nil, errors.New("mrpc: oneway调用，不应该处理任何结果")
 	}
-	return ReadMsg(conn)
+	resp, err := readMsg(conn, c.limits.maxRecv, message.ValidResp)
+	if err != nil && resp != nil {
+		// 响应超过大小限制，消息体已经被丢弃，连接可以继续使用
+		if er := put(nil); er != nil {
+			return nil, er
+		}
+		return nil, err
+	}
+	if err == nil && !message.VerifyResp(resp) {
+		// 连接上的数据可能已经损坏，不再复用
+		err = status.New(status.DataLoss, "响应校验和不匹配")
+	}
+	if err = put(err); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// methodSetup 返回方法的调用配置，没有通过 InitService 初始化的方法使用客户端的默认配置
+func (c *Client) methodSetup(service, method string) *methodSetup {
+	key := service + "." + method
+	if setup, ok := c.methods.Load(key); ok {
+		return setup.(*methodSetup)
+	}
+	setup, _ := c.methods.LoadOrStore(key, newMethodSetup(c.serializer, c.timeouts.get(service, method, 0)))
+	return setup.(*methodSetup)
+}
+
+// PoolStats 返回连接池的统计信息
+func (c *Client) PoolStats() pool.Stats {
+	return c.pool.Stats()
 }
@@ -2,11 +2,21 @@ package mrpc
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"github.com/NotFound1911/mrpc/internal/proto/gen"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/pool"
+	"github.com/NotFound1911/mrpc/serialize/msgpack"
 	"github.com/NotFound1911/mrpc/serialize/proto"
+	"github.com/NotFound1911/mrpc/status"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -92,12 +102,12 @@ func TestInitClientProxy(t *testing.T) {
 	service := &UserServiceServer{}
 	server.RegisterService(service)
 	go func() {
-		err := server.Start("tcp", ":8081")
+		err := server.Start("tcp", ":8082")
 		t.Log("err:", err)
 	}()
 	time.Sleep(time.Second * 3)
 	usClient := &UserService{}        // 客户端服务
-	client, err := NewClient(":8081") // json 协议
+	client, err := NewClient(":8082") // json 协议
 	require.NoError(t, err)
 	err = client.InitService(usClient)
 	require.NoError(t, err)
@@ -158,12 +168,12 @@ func TestOneway(t *testing.T) {
 	service := &UserServiceServer{}
 	server.RegisterService(service)
 	go func() {
-		err := server.Start("tcp", ":8081")
+		err := server.Start("tcp", ":8083")
 		t.Log("err:", err)
 	}()
 	time.Sleep(time.Second * 3)
 	usClient := &UserService{}        // 客户端服务
-	client, err := NewClient(":8081") // json 协议
+	client, err := NewClient(":8083") // json 协议
 	require.NoError(t, err)
 	err = client.InitService(usClient)
 	require.NoError(t, err)
@@ -200,32 +210,31 @@ func TestTimeout(t *testing.T) {
 	service := &UserServiceServerTimeout{t: t}
 	server.RegisterService(service)
 	go func() {
-		err := server.Start("tcp", ":8081")
+		err := server.Start("tcp", ":8084")
 		t.Log("err:", err)
 	}()
 	time.Sleep(time.Second * 3)
 	usClient := &UserService{}        // 客户端服务
-	client, err := NewClient(":8081") // json 协议
+	client, err := NewClient(":8084") // json 协议
 	require.NoError(t, err)
 	err = client.InitService(usClient)
 	require.NoError(t, err)
 	testCases := []struct {
 		name string
-		mock func() context.Context
+		mock func() (context.Context, context.CancelFunc)
 
 		wantErr  error
 		wantResp *GetByIdResp
 	}{
 		{
 			name: "timeout",
-			mock: func() context.Context {
+			mock: func() (context.Context, context.CancelFunc) {
 				service.Msg = "test"
 				service.Err = errors.New("mock error")
 				// 服务睡眠2s
 				// 超时设置了1s，客户端预期得到超时响应
 				service.sleep = 2 * time.Second
-				ctx, _ := context.WithTimeout(context.Background(), time.Second)
-				return ctx
+				return context.WithTimeout(context.Background(), time.Second)
 			},
 			wantResp: &GetByIdResp{},
 			wantErr:  context.DeadlineExceeded,
@@ -233,9 +242,414 @@ func TestTimeout(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			resp, er := usClient.GetById(tc.mock(), &GetByIdReq{Id: 123})
+			ctx, cancel := tc.mock()
+			defer cancel()
+			resp, er := usClient.GetById(ctx, &GetByIdReq{Id: 123})
 			assert.Equal(t, tc.wantErr, er)
 			assert.Equal(t, tc.wantResp, resp)
 		})
 	}
 }
+
+func TestDefaultTimeout(t *testing.T) {
+	server := NewServer()
+	// 服务端要求必须有超时时间
+	service := &UserServiceServerTimeout{t: t, sleep: time.Second, Msg: "test"}
+	server.RegisterService(service)
+	go func() {
+		err := server.Start("tcp", ":8102")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+	client, err := NewClient(":8102", ClientWithServiceTimeout("user-service", 100*time.Millisecond))
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+
+	// 调用方没有设置超时时间
+	start := time.Now()
+	_, err = usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// TestDefaultTimeoutSilentServer 服务端一直不响应时默认超时时间同样结束连接上的读取
+func TestDefaultTimeoutSilentServer(t *testing.T) {
+	startSilentServer(t, ":8111")
+	cfg := pool.DefaultConfig()
+	cfg.InitialCap = 0
+	cfg.MaxActive = 1
+	client, err := NewClient(":8111", ClientWithPoolConfig(cfg), ClientWithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+
+	_, err = usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// 直接调用 Invoke 也使用默认超时时间
+	_, err = client.Invoke(context.Background(), &message.Request{
+		ServiceName: "user-service", MethodName: "GetById", Serializer: 1, Data: []byte(`{"Id":1}`),
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Eventually(t, func() bool {
+		return client.PoolStats().Active == 0
+	}, time.Second, 10*time.Millisecond)
+	// 连接池只允许一个连接，超时的连接被丢弃，第二次调用才能建立新的连接
+	stats := client.PoolStats()
+	assert.Equal(t, int64(2), stats.Dials)
+	assert.Equal(t, int64(2), stats.Broken)
+}
+
+func TestMeta(t *testing.T) {
+	server := NewServer()
+	server.RegisterService(&UserServiceServerMeta{})
+	go func() {
+		err := server.Start("tcp", ":8085")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second * 3)
+	usClient := &UserService{}
+	client, err := NewClient(":8085")
+	require.NoError(t, err)
+	err = client.InitService(usClient)
+	require.NoError(t, err)
+	testCases := []struct {
+		name string
+		ctx  func() context.Context
+
+		wantErr     error
+		wantResp    *GetByIdResp
+		wantTrailer map[string]string
+	}{
+		{
+			name: "meta",
+			ctx: func() context.Context {
+				ctx := AppendOutgoingMeta(context.Background(), "request-id", "req-123")
+				return AppendOutgoingMeta(ctx, "tenant", "tenant-a")
+			},
+			wantResp: &GetByIdResp{
+				Msg: "req-123",
+			},
+			wantTrailer: map[string]string{
+				"tenant": "tenant-a",
+			},
+		},
+		{
+			name: "reserved key",
+			ctx: func() context.Context {
+				return AppendOutgoingMeta(context.Background(), "deadline", "0")
+			},
+			wantResp:    &GetByIdResp{},
+			wantErr:     errors.New("mrpc: 元数据 deadline 是保留字段"),
+			wantTrailer: map[string]string{},
+		},
+		{
+			name: "invalid value",
+			ctx: func() context.Context {
+				return AppendOutgoingMeta(context.Background(), "tenant", "a\nb")
+			},
+			wantResp:    &GetByIdResp{},
+			wantErr:     errors.New("mrpc: 元数据 tenant 包含非法字符"),
+			wantTrailer: map[string]string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			trailer := map[string]string{}
+			ctx := CtxWithTrailer(tc.ctx(), trailer)
+			resp, er := usClient.GetById(ctx, &GetByIdReq{Id: 123})
+			assert.Equal(t, tc.wantErr, er)
+			assert.Equal(t, tc.wantResp, resp)
+			assert.Equal(t, tc.wantTrailer, trailer)
+		})
+	}
+}
+
+func TestSerializerOverride(t *testing.T) {
+	server := NewServer()
+	service := &UserServiceServer{}
+	server.RegisterService(service)
+	require.NoError(t, server.RegisterSerializer(&proto.Serializer{}))
+	go func() {
+		err := server.Start("tcp", ":8086")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second * 3)
+	usClient := &UserService{}
+	// 默认使用 json 协议，GetByIdProto 通过标签使用 proto 协议
+	client, err := NewClient(":8086")
+	require.NoError(t, err)
+	err = client.InitService(usClient)
+	require.NoError(t, err)
+	service.Msg = "hello world"
+
+	resp, err := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, &GetByIdResp{Msg: "hello world"}, resp)
+
+	protoResp, err := usClient.GetByIdProto(context.Background(), &gen.GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", protoResp.User.Name)
+}
+
+func TestSerializerNegotiation(t *testing.T) {
+	var (
+		mutex       sync.Mutex
+		serializers []uint8
+	)
+	server := NewServer(ServerWithInterceptors(func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			mutex.Lock()
+			serializers = append(serializers, req.Serializer)
+			mutex.Unlock()
+			return next(ctx, req)
+		}
+	}))
+	service := &UserServiceServer{Msg: "hello world"}
+	server.RegisterService(service)
+	go func() {
+		err := server.Start("tcp", ":8087")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second * 3)
+	usClient := &UserService{}
+	// 服务端还不支持 msgpack
+	client, err := NewClient(":8087", ClientWithSerializer(&msgpack.Serializer{}))
+	require.NoError(t, err)
+	err = client.InitService(usClient)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		resp, err := usClient.GetById(context.Background(), &GetByIdReq{Id: 123})
+		require.NoError(t, err)
+		assert.Equal(t, &GetByIdResp{Msg: "hello world"}, resp)
+	}
+	// 第一次调用失败后切换为 json，之后直接使用 json
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []uint8{3, 1, 1}, serializers)
+}
+
+func TestLazyDial(t *testing.T) {
+	// 服务端还没有启动时也可以创建客户端
+	client, err := NewClient(":8103")
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+	call := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := usClient.GetById(ctx, &GetByIdReq{Id: 123})
+		return err
+	}
+	assert.Error(t, call())
+
+	server := NewServer()
+	server.RegisterService(&UserServiceServer{Msg: "hello"})
+	go func() {
+		err := server.Start("tcp", ":8103")
+		t.Log("err:", err)
+	}()
+	assert.Eventually(t, func() bool {
+		return call() == nil
+	}, 3*time.Second, 100*time.Millisecond)
+
+	// 服务端关闭连接后，坏掉的连接被丢弃而不是放回连接池
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+	assert.Error(t, call())
+	stats := client.PoolStats()
+	assert.Equal(t, 0, stats.Active)
+	assert.Greater(t, stats.Broken, int64(0))
+}
+
+// UserServiceServerSize 返回长度为请求 Id 的 Msg
+type UserServiceServerSize struct{}
+
+func (u *UserServiceServerSize) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	return &GetByIdResp{Msg: strings.Repeat("a", req.Id)}, nil
+}
+func (u *UserServiceServerSize) Name() string {
+	return "user-service"
+}
+
+func TestMsgSize(t *testing.T) {
+	server := NewServer(ServerWithMaxRecvSize(1024), ServerWithMaxSendSize(4096), ServerWithChunkSize(256))
+	server.RegisterService(&UserServiceServerSize{})
+	go func() {
+		err := server.Start("tcp", ":8105")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+	client, err := NewClient(":8105", ClientWithMaxRecvSize(2048), ClientWithMaxSendSize(8192), ClientWithChunkSize(256))
+	require.NoError(t, err)
+	defer client.Close()
+
+	testCases := []struct {
+		name string
+		req  *message.Request
+
+		wantCode status.Code
+		wantMsg  int
+	}{
+		{
+			name: "chunked",
+			req: &message.Request{
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Serializer:  1,
+				Data:        []byte(`{"Id":600,"Padding":"` + strings.Repeat("b", 600) + `"}`),
+			},
+			wantCode: status.OK,
+			wantMsg:  600,
+		},
+		{
+			name: "response exceeds client limit",
+			req: &message.Request{
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Serializer:  1,
+				Data:        []byte(`{"Id":3000}`),
+			},
+			wantCode: status.ResourceExhausted,
+		},
+		{
+			name: "response exceeds server limit",
+			req: &message.Request{
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Serializer:  1,
+				Data:        []byte(`{"Id":5000}`),
+			},
+			wantCode: status.ResourceExhausted,
+		},
+		{
+			name: "request exceeds server limit",
+			req: &message.Request{
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Serializer:  1,
+				Data:        []byte(`{"Id":1,"Padding":"` + strings.Repeat("b", 2000) + `"}`),
+			},
+			wantCode: status.ResourceExhausted,
+		},
+		{
+			name: "request exceeds client limit",
+			req: &message.Request{
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Serializer:  1,
+				Data:        []byte(`{"Id":1,"Padding":"` + strings.Repeat("b", 10000) + `"}`),
+			},
+			wantCode: status.ResourceExhausted,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			resp, err := client.Invoke(ctx, tc.req)
+			assert.Equal(t, tc.wantCode, status.ResultCode(resp, err))
+			if tc.wantCode != status.OK {
+				return
+			}
+			var res GetByIdResp
+			require.NoError(t, json.Unmarshal(resp.Data, &res))
+			assert.Equal(t, tc.wantMsg, len(res.Msg))
+		})
+	}
+	// 超过限制的消息体被丢弃，连接仍然可以使用
+	assert.Equal(t, int64(0), client.PoolStats().Broken)
+}
+
+// TestLegacyVersion 版本 0 的客户端只认识最初的响应格式，服务端不能带上状态码和元数据
+func TestLegacyVersion(t *testing.T) {
+	server := NewServer()
+	server.RegisterService(&UserServiceServer{Msg: "hello", Err: status.New(status.NotFound, "not found")})
+	go func() {
+		err := server.Start("tcp", ":8109")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	conn, err := net.Dial("tcp", ":8109")
+	require.NoError(t, err)
+	defer conn.Close()
+	req := &message.Request{
+		RequestID:   1,
+		Serializer:  1,
+		ServiceName: "user-service",
+		MethodName:  "GetById",
+		Data:        []byte(`{"Id":123}`),
+	}
+	req.CalHeaderLen()
+	req.CalBodyLen()
+	_, err = conn.Write(message.EncodeReq(req))
+	require.NoError(t, err)
+	respBs, err := ReadMsg(conn)
+	require.NoError(t, err)
+	// 固定头部 15 字节之后直接是错误信息
+	headLength := binary.BigEndian.Uint32(respBs[:4])
+	assert.Equal(t, uint32(15+len("not found")), headLength)
+	assert.Equal(t, "not found", string(respBs[15:headLength]))
+	assert.Equal(t, `{"Msg":"hello"}`, string(respBs[headLength:]))
+}
+
+// startSilentServer 读取请求但是从不响应的服务端
+func startSilentServer(t *testing.T, addr string) {
+	listener, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+}
+
+// TestSendDeadline 超时或者取消的调用不能一直占用连接
+func TestSendDeadline(t *testing.T) {
+	startSilentServer(t, ":8110")
+	cfg := pool.DefaultConfig()
+	cfg.InitialCap = 0
+	cfg.MaxActive = 2
+	client, err := NewClient(":8110", ClientWithPoolConfig(cfg))
+	require.NoError(t, err)
+	defer client.Close()
+	newReq := func() *message.Request {
+		return &message.Request{ServiceName: "user-service", MethodName: "GetById", Serializer: 1, Data: []byte(`{"Id":1}`)}
+	}
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = client.Invoke(ctx, newReq())
+		cancel()
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	// 没有超时时间的调用被取消
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = client.Invoke(ctx, newReq())
+	assert.Equal(t, context.Canceled, err)
+
+	assert.Eventually(t, func() bool {
+		return client.PoolStats().Active == 0
+	}, time.Second, 10*time.Millisecond)
+	// 超时的连接都被丢弃，每次调用都建立了新的连接
+	stats := client.PoolStats()
+	assert.Equal(t, 0, stats.Idle)
+	assert.Equal(t, int64(3), stats.Dials)
+	assert.Equal(t, int64(3), stats.Broken)
+}
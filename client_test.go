@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/serialize"
 	"github.com/NotFound1911/mrpc/serialize/json"
+	"github.com/NotFound1911/mrpc/serialize/proto"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
 	"testing"
+	"time"
 )
 
 // cmockgen -destination=mock_proxy_test.gen.go -package=mrpc -source=types.go Proxy
@@ -34,14 +39,40 @@ func Test_setFuncField(t *testing.T) {
 				return NewMockProxy(controller)
 			},
 		},
+		{
+			name:    "unknown serializer",
+			service: &UserServiceUnknownSerializer{},
+			wantErr: errors.Join(errors.New("mrpc: 字段 GetById 使用了未注册的序列化协议 xml")),
+			mock: func(controller *gomock.Controller) Proxy {
+				return NewMockProxy(controller)
+			},
+		},
+		{
+			name:    "invalid fields",
+			service: &UserServiceInvalid{},
+			wantErr: errors.Join(
+				errors.New("mrpc: 字段 Timeout 的类型 time.Duration 不是函数"),
+				errors.New("mrpc: 字段 NoContext 的类型 func(*mrpc.GetByIdReq) (*mrpc.GetByIdResp, error) 不是 func(context.Context, *Req) (*Resp, error)"),
+				errors.New("mrpc: 字段 NoPointer 的类型 func(context.Context, *mrpc.GetByIdReq) (mrpc.GetByIdResp, error) 不是 func(context.Context, *Req) (*Resp, error)"),
+				errors.New("mrpc: 字段 NoName 的远程方法名不能为空"),
+				errors.New("mrpc: 字段 BadTime 的超时时间 abc 不合法"),
+			),
+			mock: func(controller *gomock.Controller) Proxy {
+				return NewMockProxy(controller)
+			},
+		},
 		{
 			name:    "user service",
 			service: &UserService{},
 			mock: func(controller *gomock.Controller) Proxy {
 				p := NewMockProxy(controller)
 				p.EXPECT().Invoke(gomock.Any(), &message.Request{
+					HeadLength:  36,
+					BodyLength:  10,
+					Serializer:  1,
 					ServiceName: "user-service",
 					MethodName:  "GetById",
+					Meta:        map[string]string{},
 					Data:        []byte(`{"Id":123}`),
 				}).Return(&message.Response{}, nil)
 				return p
@@ -49,11 +80,13 @@ func Test_setFuncField(t *testing.T) {
 		},
 	}
 	s := json.Serializer{}
+	registry, err := serialize.NewRegistry(s, proto.Serializer{})
+	require.NoError(t, err)
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			err := setFuncField(tc.service, tc.mock(ctrl), s)
+			err := setFuncField(tc.service, tc.mock(ctrl), s, registry, timeoutConfig{}, nil)
 			assert.Equal(t, tc.wantErr, err)
 			if err != nil {
 				return
@@ -64,3 +97,132 @@ func Test_setFuncField(t *testing.T) {
 		})
 	}
 }
+
+func Test_setFuncFieldRename(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p := NewMockProxy(ctrl)
+	p.EXPECT().Invoke(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			assert.Equal(t, "GetById", req.MethodName)
+			return &message.Response{Data: []byte(`{"Msg":"hello"}`)}, nil
+		})
+	s := json.Serializer{}
+	registry, err := serialize.NewRegistry(s)
+	require.NoError(t, err)
+
+	service := &UserServiceRename{}
+	require.NoError(t, setFuncField(service, p, s, registry, timeoutConfig{}, nil))
+	assert.Nil(t, service.Helper)
+	resp, err := service.Get(context.Background(), &GetByIdReq{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Msg)
+}
+
+func Test_setFuncFieldTimeout(t *testing.T) {
+	testCases := []struct {
+		name     string
+		timeouts timeoutConfig
+		// ctxTimeout 调用方设置的超时时间
+		ctxTimeout time.Duration
+		call       func(ctx context.Context, service *UserServiceTimeout) error
+
+		// wantTimeout 为 0 表示没有超时时间
+		wantTimeout time.Duration
+	}{
+		{
+			name: "no timeout",
+			call: func(ctx context.Context, service *UserServiceTimeout) error {
+				_, err := service.GetByIds(ctx, &GetByIdReq{})
+				return err
+			},
+		},
+		{
+			name:     "client default",
+			timeouts: timeoutConfig{def: time.Second},
+			call: func(ctx context.Context, service *UserServiceTimeout) error {
+				_, err := service.GetByIds(ctx, &GetByIdReq{})
+				return err
+			},
+			wantTimeout: time.Second,
+		},
+		{
+			name: "service",
+			timeouts: timeoutConfig{
+				def:      time.Second,
+				services: map[string]time.Duration{"user-service": 2 * time.Second},
+			},
+			call: func(ctx context.Context, service *UserServiceTimeout) error {
+				_, err := service.GetByIds(ctx, &GetByIdReq{})
+				return err
+			},
+			wantTimeout: 2 * time.Second,
+		},
+		{
+			name: "tag",
+			timeouts: timeoutConfig{
+				services: map[string]time.Duration{"user-service": 2 * time.Second},
+			},
+			call: func(ctx context.Context, service *UserServiceTimeout) error {
+				_, err := service.GetById(ctx, &GetByIdReq{})
+				return err
+			},
+			wantTimeout: 200 * time.Millisecond,
+		},
+		{
+			name: "method",
+			timeouts: timeoutConfig{
+				methods: map[string]time.Duration{"user-service.GetById": 3 * time.Second},
+			},
+			call: func(ctx context.Context, service *UserServiceTimeout) error {
+				_, err := service.GetById(ctx, &GetByIdReq{})
+				return err
+			},
+			wantTimeout: 3 * time.Second,
+		},
+		{
+			name: "caller deadline",
+			timeouts: timeoutConfig{
+				methods: map[string]time.Duration{"user-service.GetById": 3 * time.Second},
+			},
+			ctxTimeout: 5 * time.Second,
+			call: func(ctx context.Context, service *UserServiceTimeout) error {
+				_, err := service.GetById(ctx, &GetByIdReq{})
+				return err
+			},
+			wantTimeout: 5 * time.Second,
+		},
+	}
+	s := json.Serializer{}
+	registry, err := serialize.NewRegistry(s)
+	require.NoError(t, err)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			p := NewMockProxy(ctrl)
+			p.EXPECT().Invoke(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, req *message.Request) (*message.Response, error) {
+					deadline, ok := ctx.Deadline()
+					if tc.wantTimeout == 0 {
+						assert.False(t, ok)
+						assert.NotContains(t, req.Meta, metaDeadline)
+						return &message.Response{}, nil
+					}
+					require.True(t, ok)
+					assert.InDelta(t, tc.wantTimeout, time.Until(deadline), float64(100*time.Millisecond))
+					assert.Equal(t, strconv.FormatInt(deadline.UnixMilli(), 10), req.Meta[metaDeadline])
+					return &message.Response{}, nil
+				})
+			service := &UserServiceTimeout{}
+			require.NoError(t, setFuncField(service, p, s, registry, tc.timeouts, nil))
+			ctx := context.Background()
+			if tc.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.ctxTimeout)
+				defer cancel()
+			}
+			assert.NoError(t, tc.call(ctx, service))
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+var funcs = template.FuncMap{
+	"lowerFirst": lowerFirst,
+}
+
+var serviceTpl = template.Must(template.New("service").Funcs(funcs).Parse(`// Code generated by mrpcgen. DO NOT EDIT.
+// source: {{ .Source }}
+
+package {{ .Package }}
+
+import (
+	context "context"
+	mrpc "github.com/NotFound1911/mrpc"
+{{- range .Imports }}
+	{{ .Name }} "{{ .Path }}"
+{{- end }}
+)
+
+// {{ .Name }}Name 服务名
+const {{ .Name }}Name = "{{ .ServiceName }}"
+
+// {{ .Name }}Client 通过 mrpc.Client.InitService 初始化后使用
+type {{ .Name }}Client struct {
+{{- range .Methods }}
+	{{ .Name }} func(ctx context.Context, req {{ .Req }}) ({{ .Resp }}, error)
+{{- end }}
+}
+
+func (c {{ .Name }}Client) Name() string {
+	return {{ .Name }}Name
+}
+
+// New{{ .Name }}Client 初始化客户端，返回的结果实现了 {{ .Name }}
+func New{{ .Name }}Client(c *mrpc.Client) ({{ .Name }}, error) {
+	stub := &{{ .Name }}Client{}
+	if err := c.InitService(stub); err != nil {
+		return nil, err
+	}
+	return {{ lowerFirst .Name }}Client{stub: stub}, nil
+}
+
+type {{ lowerFirst .Name }}Client struct {
+	stub *{{ .Name }}Client
+}
+{{ $name := .Name }}
+{{- range .Methods }}
+func (c {{ lowerFirst $name }}Client) {{ .Name }}(ctx context.Context, req {{ .Req }}) ({{ .Resp }}, error) {
+	return c.stub.{{ .Name }}(ctx, req)
+}
+{{ end }}
+// {{ lowerFirst .Name }}ServerStub 为实现补充服务名
+type {{ lowerFirst .Name }}ServerStub struct {
+	{{ .Name }}
+}
+
+func (s *{{ lowerFirst .Name }}ServerStub) Name() string {
+	return {{ .Name }}Name
+}
+
+// Register{{ .Name }}Server 注册服务
+func Register{{ .Name }}Server(s *mrpc.Server, impl {{ .Name }}) {
+	s.RegisterService(&{{ lowerFirst .Name }}ServerStub{ {{- .Name }}: impl})
+}
+`))
+
+var mockTpl = template.Must(template.New("mock").Funcs(funcs).Parse(`// Code generated by mrpcgen. DO NOT EDIT.
+// Source: {{ .Source }}
+
+package {{ .Package }}
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+{{- range .Imports }}
+	{{ .Name }} "{{ .Path }}"
+{{- end }}
+)
+
+// Mock{{ .Name }} is a mock of {{ .Name }} interface.
+type Mock{{ .Name }} struct {
+	ctrl     *gomock.Controller
+	recorder *Mock{{ .Name }}MockRecorder
+}
+
+// Mock{{ .Name }}MockRecorder is the mock recorder for Mock{{ .Name }}.
+type Mock{{ .Name }}MockRecorder struct {
+	mock *Mock{{ .Name }}
+}
+
+// NewMock{{ .Name }} creates a new mock instance.
+func NewMock{{ .Name }}(ctrl *gomock.Controller) *Mock{{ .Name }} {
+	mock := &Mock{{ .Name }}{ctrl: ctrl}
+	mock.recorder = &Mock{{ .Name }}MockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mock{{ .Name }}) EXPECT() *Mock{{ .Name }}MockRecorder {
+	return m.recorder
+}
+{{ $name := .Name }}
+{{- range .Methods }}
+// {{ .Name }} mocks base method.
+func (m *Mock{{ $name }}) {{ .Name }}(ctx context.Context, req {{ .Req }}) ({{ .Resp }}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "{{ .Name }}", ctx, req)
+	ret0, _ := ret[0].({{ .Resp }})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// {{ .Name }} indicates an expected call of {{ .Name }}.
+func (mr *Mock{{ $name }}MockRecorder) {{ .Name }}(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "{{ .Name }}", reflect.TypeOf((*Mock{{ $name }})(nil).{{ .Name }}), ctx, req)
+}
+{{ end }}`))
+
+func generateService(itf *Interface) ([]byte, error) {
+	return execute(serviceTpl, itf)
+}
+
+func generateMock(itf *Interface) ([]byte, error) {
+	return execute(mockTpl, itf)
+}
+
+func execute(tpl *template.Template, itf *Interface) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, itf); err != nil {
+		return nil, err
+	}
+	res, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("mrpcgen: 格式化生成的代码失败: %w", err)
+	}
+	return res, nil
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
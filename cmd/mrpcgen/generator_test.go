@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const exampleDir = "../../internal/example/user"
+
+// TestRun_Golden 生成的代码需要与 internal/example/user 中的代码一致
+// 修改生成逻辑后在 internal/example/user 下执行 go generate 更新
+func TestRun_Golden(t *testing.T) {
+	dir := t.TempDir()
+	err := run(filepath.Join(exampleDir, "user.go"), "UserService", "user-service",
+		filepath.Join(dir, "service.go"), filepath.Join(dir, "mock.go"))
+	require.NoError(t, err)
+	for src, golden := range map[string]string{
+		"service.go": "userservice_mrpc.gen.go",
+		"mock.go":    "mock_userservice_mrpc_test.go",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, src))
+		require.NoError(t, err)
+		want, err := os.ReadFile(filepath.Join(exampleDir, golden))
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got), golden)
+	}
+}
+
+func TestParseInterface(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		typeName string
+
+		wantErr string
+		wantItf *Interface
+	}{
+		{
+			name: "grouped params",
+			src: `package user
+import (
+	"context"
+	pb "example.com/user/proto"
+)
+type UserService interface {
+	GetById(ctx context.Context, req *pb.GetByIdReq) (resp *GetByIdResp, err error)
+}`,
+			typeName: "UserService",
+			wantItf: &Interface{
+				Source:      "user.go",
+				Package:     "user",
+				Name:        "UserService",
+				ServiceName: "UserService",
+				Methods: []Method{
+					{Name: "GetById", Req: "*pb.GetByIdReq", Resp: "*GetByIdResp"},
+				},
+				Imports: []Import{{Name: "pb", Path: "example.com/user/proto"}},
+			},
+		},
+		{
+			name:     "not found",
+			src:      "package user\ntype UserService struct{}",
+			typeName: "UserService",
+			wantErr:  "mrpcgen: user.go 中没有找到接口 UserService",
+		},
+		{
+			name: "no context",
+			src: `package user
+type UserService interface {
+	GetById(req *GetByIdReq) (*GetByIdResp, error)
+}`,
+			typeName: "UserService",
+			wantErr:  "mrpcgen: 方法 UserService.GetById 的签名必须是 func(context.Context, *Req) (*Resp, error)",
+		},
+		{
+			name: "non pointer response",
+			src: `package user
+import "context"
+type UserService interface {
+	GetById(ctx context.Context, req *GetByIdReq) (GetByIdResp, error)
+}`,
+			typeName: "UserService",
+			wantErr:  "mrpcgen: 方法 UserService.GetById 的签名必须是 func(context.Context, *Req) (*Resp, error)",
+		},
+		{
+			name: "embedded",
+			src: `package user
+type UserService interface {
+	Base
+}`,
+			typeName: "UserService",
+			wantErr:  "mrpcgen: 接口 UserService 不支持嵌入其他接口",
+		},
+		{
+			name: "empty",
+			src: `package user
+type UserService interface {}`,
+			typeName: "UserService",
+			wantErr:  "mrpcgen: 接口 UserService 没有方法",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "user.go"), []byte(tc.src), 0644))
+			itf, err := parseInterface(filepath.Join(dir, "user.go"), tc.typeName)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantItf, itf)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// mrpcgen 根据 Go 接口生成 mrpc 客户端、服务端适配器以及 gomock 风格的 mock
+//
+// 接口中的每个方法都必须是 func(context.Context, *Req) (*Resp, error) 的形式:
+//
+//	//go:generate go run github.com/NotFound1911/mrpc/cmd/mrpcgen -type UserService
+//	type UserService interface {
+//		GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+//	}
+//
+// 默认生成:
+//   - <type>_mrpc.gen.go: 客户端 <Type>Client、New<Type>Client 以及 Register<Type>Server
+//   - mock_<type>_mrpc_test.go: Mock<Type>，以 _test.go 结尾，gomock 不会进入业务代码的构建
+//     其他包需要使用 mock 时通过 -mock_output 指定非测试文件
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	source := flag.String("source", os.Getenv("GOFILE"), "接口所在的源文件，go generate 时默认为当前文件")
+	typeName := flag.String("type", "", "接口名")
+	serviceName := flag.String("service", "", "服务名，默认为接口名")
+	output := flag.String("output", "", "客户端与服务端代码的输出文件，默认为 <type>_mrpc.gen.go")
+	mockOutput := flag.String("mock_output", "", "mock 的输出文件，默认为测试文件 mock_<type>_mrpc_test.go，- 表示不生成")
+	flag.Parse()
+
+	if *source == "" || *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*source, *typeName, *serviceName, *output, *mockOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(source, typeName, serviceName, output, mockOutput string) error {
+	itf, err := parseInterface(source, typeName)
+	if err != nil {
+		return err
+	}
+	if serviceName != "" {
+		itf.ServiceName = serviceName
+	}
+	dir := filepath.Dir(source)
+	lower := strings.ToLower(typeName)
+	if output == "" {
+		output = filepath.Join(dir, lower+"_mrpc.gen.go")
+	}
+	code, err := generateService(itf)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(output, code, 0644); err != nil {
+		return err
+	}
+	if mockOutput == "-" {
+		return nil
+	}
+	if mockOutput == "" {
+		mockOutput = filepath.Join(dir, "mock_"+lower+"_mrpc_test.go")
+	}
+	code, err = generateMock(itf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mockOutput, code, 0644)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Interface 解析后的接口
+type Interface struct {
+	// Source 源文件名，写入生成代码的头部
+	Source      string
+	Package     string
+	Name        string
+	ServiceName string
+	Methods     []Method
+	// Imports 方法签名中用到的其他包，按路径排序
+	Imports []Import
+}
+
+type Method struct {
+	Name string
+	// Req 和 Resp 为类型的源码形式，例如 *GetByIdReq、*gen.User
+	Req  string
+	Resp string
+}
+
+type Import struct {
+	Name string
+	Path string
+}
+
+// parseInterface 从源文件中解析接口
+// 只做语法分析，不做类型检查，因此要求 context 包使用默认的包名
+func parseInterface(filename, typeName string) (*Interface, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	var itfType *ast.InterfaceType
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || spec.Name.Name != typeName {
+			return itfType == nil
+		}
+		if typ, ok := spec.Type.(*ast.InterfaceType); ok {
+			itfType = typ
+		}
+		return false
+	})
+	if itfType == nil {
+		return nil, fmt.Errorf("mrpcgen: %s 中没有找到接口 %s", filepath.Base(filename), typeName)
+	}
+
+	imports := make(map[string]string, len(file.Imports))
+	for _, imp := range file.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := path.Base(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imports[name] = p
+	}
+
+	res := &Interface{
+		Source:      filepath.Base(filename),
+		Package:     file.Name.Name,
+		Name:        typeName,
+		ServiceName: typeName,
+	}
+	used := make(map[string]struct{}, 4)
+	for _, field := range itfType.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("mrpcgen: 接口 %s 不支持嵌入其他接口", typeName)
+		}
+		name := field.Names[0].Name
+		params, results := flatten(fn.Params), flatten(fn.Results)
+		if len(params) != 2 || len(results) != 2 ||
+			!isSelector(params[0], "context", "Context") || !isPointer(params[1]) ||
+			!isPointer(results[0]) || !isIdent(results[1], "error") {
+			return nil, fmt.Errorf("mrpcgen: 方法 %s.%s 的签名必须是 func(context.Context, *Req) (*Resp, error)", typeName, name)
+		}
+		for _, expr := range []ast.Expr{params[1], results[0]} {
+			ast.Inspect(expr, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if x, ok := sel.X.(*ast.Ident); ok {
+						used[x.Name] = struct{}{}
+					}
+				}
+				return true
+			})
+		}
+		res.Methods = append(res.Methods, Method{
+			Name: name,
+			Req:  exprString(fset, params[1]),
+			Resp: exprString(fset, results[0]),
+		})
+	}
+	if len(res.Methods) == 0 {
+		return nil, fmt.Errorf("mrpcgen: 接口 %s 没有方法", typeName)
+	}
+	for name := range used {
+		p, ok := imports[name]
+		if !ok {
+			return nil, fmt.Errorf("mrpcgen: 接口 %s 使用了未导入的包 %s", typeName, name)
+		}
+		res.Imports = append(res.Imports, Import{Name: name, Path: p})
+	}
+	sort.Slice(res.Imports, func(i, j int) bool {
+		return res.Imports[i].Path < res.Imports[j].Path
+	})
+	return res, nil
+}
+
+// flatten 将 (a, b *T) 这样的参数列表展开为每个参数一个类型
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	res := make([]ast.Expr, 0, len(fields.List))
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			res = append(res, f.Type)
+		}
+	}
+	return res
+}
+
+func isSelector(expr ast.Expr, pkg, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	return ok && isIdent(sel.X, pkg) && sel.Sel.Name == name
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+func isPointer(expr ast.Expr) bool {
+	_, ok := expr.(*ast.StarExpr)
+	return ok
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/NotFound1911/mrpc/serialize/msgpack"
+)
+
+// codec 在 JSON 与具体的序列化协议之间转换
+type codec struct {
+	fromJSON func(data []byte) ([]byte, error)
+	toJSON   func(data []byte) ([]byte, error)
+}
+
+var codecs = map[uint8]codec{
+	1: {
+		fromJSON: func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, data); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		},
+		toJSON: func(data []byte) ([]byte, error) {
+			return data, nil
+		},
+	},
+	// proto 没有描述文件无法与 JSON 互转，请求和响应都是 base64 编码的 JSON 字符串
+	2: {
+		fromJSON: func(data []byte) ([]byte, error) {
+			var val string
+			if err := json.Unmarshal(data, &val); err != nil {
+				return nil, errors.New("proto 请求数据需要是 base64 编码的 JSON 字符串")
+			}
+			return base64.StdEncoding.DecodeString(val)
+		},
+		toJSON: func(data []byte) ([]byte, error) {
+			return json.Marshal(data)
+		},
+	},
+	3: {
+		fromJSON: func(data []byte) ([]byte, error) {
+			val, err := decodeJSON(data)
+			if err != nil {
+				return nil, err
+			}
+			return msgpack.Serializer{}.Encode(val)
+		},
+		toJSON: func(data []byte) ([]byte, error) {
+			var val any
+			if err := (msgpack.Serializer{}).Decode(data, &val); err != nil {
+				return nil, err
+			}
+			return json.Marshal(val)
+		},
+	},
+}
+
+// decodeJSON 解析 JSON，整数保持为 int64，避免服务端把浮点数解析到整数字段时失败
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var val any
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	return convertNumber(val), nil
+}
+
+func convertNumber(val any) any {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, e := range v {
+			v[k] = convertNumber(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = convertNumber(e)
+		}
+	}
+	return val
+}
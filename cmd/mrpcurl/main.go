@@ -0,0 +1,186 @@
+// mrpcurl 命令行调用 mrpc 服务，用于排查问题
+//
+// 安装:
+//
+//	go install github.com/NotFound1911/mrpc/cmd/mrpcurl@latest
+//
+// 使用:
+//
+//	mrpcurl -addr localhost:8081 -service user-service -method GetById -meta tenant=a -d '{"Id":12}'
+//
+// 请求数据统一使用 JSON 描述，-d @file 从文件读取，-d @- 从标准输入读取
+// -serializer 为 json 以外的协议时会将 JSON 转换为对应的编码，响应数据同样转换为 JSON 输出
+// -v 会以十六进制输出请求和响应的完整帧
+// -list 通过服务端的反射服务列出所有服务和方法，需要服务端使用 mrpc.ServerWithReflection
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// 退出码
+const (
+	exitOK = iota
+	// exitRespError 服务端返回了错误
+	exitRespError
+	// exitUsage 参数错误
+	exitUsage
+	// exitFailure 网络等其他错误
+	exitFailure
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// metaFlag 可以重复出现的 k=v 参数
+type metaFlag map[string]string
+
+func (m metaFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metaFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("元数据 %q 不是 k=v 的形式", s)
+	}
+	// 保留字段或者包含分隔符的元数据会破坏请求帧
+	if err := mrpc.CheckMeta(k, v); err != nil {
+		return err
+	}
+	m[k] = v
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mrpcurl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addr := flags.String("addr", "localhost:8081", "服务端地址")
+	service := flags.String("service", "", "服务名")
+	method := flags.String("method", "", "方法名")
+	serializer := flags.Uint("serializer", 1, "序列化协议编号，1 json，2 proto（数据为 base64 编码的 JSON 字符串），3 msgpack")
+	data := flags.String("d", "{}", "JSON 格式的请求数据，@file 从文件读取，@- 从标准输入读取")
+	timeout := flags.Duration("timeout", 5*time.Second, "超时时间")
+	verbose := flags.Bool("v", false, "以十六进制输出请求和响应帧")
+	list := flags.Bool("list", false, "列出服务端注册的服务和方法")
+	meta := metaFlag{}
+	flags.Var(meta, "meta", "元数据 k=v，可以重复指定")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *list {
+		*service, *method, *serializer, *data = mrpc.ReflectionServiceName, "ListServices", 1, "{}"
+	}
+	if *service == "" || *method == "" {
+		fmt.Fprintln(stderr, "mrpcurl: 必须指定 -service 和 -method")
+		flags.Usage()
+		return exitUsage
+	}
+	if *serializer > 255 {
+		fmt.Fprintf(stderr, "mrpcurl: 序列化协议编号 %d 超出范围\n", *serializer)
+		return exitUsage
+	}
+	c, ok := codecs[uint8(*serializer)]
+	if !ok {
+		fmt.Fprintf(stderr, "mrpcurl: 不支持序列化协议 %d\n", *serializer)
+		return exitUsage
+	}
+	jsonData, err := readData(*data, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "mrpcurl: %v\n", err)
+		return exitUsage
+	}
+	reqData, err := c.fromJSON(jsonData)
+	if err != nil {
+		fmt.Fprintf(stderr, "mrpcurl: 转换请求数据失败: %v\n", err)
+		return exitUsage
+	}
+
+	req := &message.Request{
+		RequestID:   1,
+		Version:     message.ProtocolVersion,
+		Serializer:  uint8(*serializer),
+		ServiceName: *service,
+		MethodName:  *method,
+		Meta:        meta,
+		Data:        reqData,
+	}
+	req.CalHeaderLen()
+	req.CalBodyLen()
+	resp, err := call(*addr, req, *timeout, *verbose, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "mrpcurl: %v\n", err)
+		return exitFailure
+	}
+	if len(resp.Error) > 0 || resp.Status != 0 {
+		printResp(stdout, resp, c)
+		return exitRespError
+	}
+	if *list {
+		if err = printServices(stdout, resp.Data); err != nil {
+			fmt.Fprintf(stderr, "mrpcurl: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	printResp(stdout, resp, c)
+	return exitOK
+}
+
+func readData(data string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data == "@-":
+		return io.ReadAll(stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	default:
+		return []byte(data), nil
+	}
+}
+
+// call 发送一次请求并读取响应
+func call(addr string, req *message.Request, timeout time.Duration, verbose bool, out io.Writer) (*message.Response, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	reqBs := message.EncodeReq(req)
+	if verbose {
+		dumpFrame(out, "> request", reqBs)
+	}
+	if _, err = conn.Write(reqBs); err != nil {
+		return nil, err
+	}
+	respBs, err := mrpc.ReadMsg(conn)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("服务端关闭了连接")
+		}
+		return nil, err
+	}
+	if verbose {
+		dumpFrame(out, "< response", respBs)
+	}
+	if !message.ValidResp(respBs) {
+		return nil, errors.New("响应帧格式错误")
+	}
+	return message.DecodeResp(respBs), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/internal/proto/gen"
+	"github.com/NotFound1911/mrpc/serialize/msgpack"
+	"github.com/NotFound1911/mrpc/serialize/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+type GetByIdReq struct {
+	Id int `json:"id"`
+}
+
+type GetByIdResp struct {
+	Name string `json:"name"`
+}
+
+type UserServiceServer struct{}
+
+func (u *UserServiceServer) Name() string {
+	return "user-service"
+}
+
+func (u *UserServiceServer) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	if req.Id == 0 {
+		return nil, errors.New("id 不能为空")
+	}
+	_ = mrpc.SetTrailer(ctx, "tenant", mrpc.IncomingMeta(ctx)["tenant"])
+	return &GetByIdResp{Name: "Tom"}, nil
+}
+
+func (u *UserServiceServer) GetByIdProto(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) {
+	return &gen.GetByIdResp{User: &gen.User{Id: req.Id, Name: "Tom"}}, nil
+}
+
+func TestRun(t *testing.T) {
+	server := mrpc.NewServer(mrpc.ServerWithReflection())
+	server.RegisterService(&UserServiceServer{})
+	require.NoError(t, server.RegisterSerializer(msgpack.Serializer{}))
+	require.NoError(t, server.RegisterSerializer(&proto.Serializer{}))
+	go func() {
+		err := server.Start("tcp", ":8096")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	testCases := []struct {
+		name  string
+		args  []string
+		stdin string
+
+		wantCode   int
+		wantOut    []string
+		wantStderr string
+	}{
+		{
+			name:     "json",
+			args:     []string{"-addr", ":8096", "-service", "user-service", "-method", "GetById", "-meta", "tenant=a", "-d", `{"id": 12}`},
+			wantCode: exitOK,
+			wantOut:  []string{"Status:     OK\n", "Meta:       tenant=a\n", "Data:\n{\n  \"name\": \"Tom\"\n}\n"},
+		},
+		{
+			name:     "msgpack from stdin",
+			args:     []string{"-addr", ":8096", "-service", "user-service", "-method", "GetById", "-serializer", "3", "-d", "@-"},
+			stdin:    `{"id": 12}`,
+			wantCode: exitOK,
+			wantOut:  []string{"Serializer: 3\n", "Data:\n{\n  \"name\": \"Tom\"\n}\n"},
+		},
+		{
+			name: "proto",
+			// {id: 12}
+			args:     []string{"-addr", ":8096", "-service", "user-service", "-method", "GetByIdProto", "-serializer", "2", "-d", `"CAw="`},
+			wantCode: exitOK,
+			// {user: {id: 12, name: "Tom"}}
+			wantOut: []string{"Serializer: 2\n", "Data:\n\"CgcIDBIDVG9t\"\n"},
+		},
+		{
+			name:       "proto not base64 string",
+			args:       []string{"-service", "user-service", "-method", "GetByIdProto", "-serializer", "2", "-d", `{"id": 12}`},
+			wantCode:   exitUsage,
+			wantStderr: "proto 请求数据需要是 base64 编码的 JSON 字符串",
+		},
+		{
+			name:     "verbose",
+			args:     []string{"-addr", ":8096", "-service", "user-service", "-method", "GetById", "-v", "-d", `{"id": 12}`},
+			wantCode: exitOK,
+			wantOut:  []string{"> request frame (", "< response frame (", "|ser-service.GetB|"},
+		},
+		{
+			name:     "list",
+			args:     []string{"-addr", ":8096", "-list"},
+			wantCode: exitOK,
+			wantOut: []string{
+				"mrpc.reflection\n  ListServices(*mrpc.ListServicesReq) *mrpc.ListServicesResp\n",
+				"user-service\n  GetById(*main.GetByIdReq) *main.GetByIdResp\n",
+			},
+		},
+		{
+			name:     "resp error",
+			args:     []string{"-addr", ":8096", "-service", "user-service", "-method", "GetById"},
+			wantCode: exitRespError,
+			wantOut:  []string{"Status:     Unknown\n", "Error:      id 不能为空\n"},
+		},
+		{
+			name:       "missing method",
+			args:       []string{"-addr", ":8096", "-service", "user-service"},
+			wantCode:   exitUsage,
+			wantStderr: "mrpcurl: 必须指定 -service 和 -method",
+		},
+		{
+			name:       "invalid meta",
+			args:       []string{"-meta", "tenant"},
+			wantCode:   exitUsage,
+			wantStderr: `元数据 "tenant" 不是 k=v 的形式`,
+		},
+		{
+			name:       "reserved meta",
+			args:       []string{"-meta", "deadline=1"},
+			wantCode:   exitUsage,
+			wantStderr: "mrpc: 元数据 deadline 是保留字段",
+		},
+		{
+			name:       "meta with separator",
+			args:       []string{"-meta", "tenant=a\rb"},
+			wantCode:   exitUsage,
+			wantStderr: "mrpc: 元数据 tenant 包含非法字符",
+		},
+		{
+			name:       "unsupported serializer",
+			args:       []string{"-service", "user-service", "-method", "GetById", "-serializer", "9"},
+			wantCode:   exitUsage,
+			wantStderr: "mrpcurl: 不支持序列化协议 9",
+		},
+		{
+			name:       "invalid json",
+			args:       []string{"-service", "user-service", "-method", "GetById", "-d", "{"},
+			wantCode:   exitUsage,
+			wantStderr: "mrpcurl: 转换请求数据失败",
+		},
+		{
+			name:       "connection refused",
+			args:       []string{"-addr", ":8097", "-service", "user-service", "-method", "GetById"},
+			wantCode:   exitFailure,
+			wantStderr: "connection refused",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			code := run(tc.args, strings.NewReader(tc.stdin), stdout, stderr)
+			assert.Equal(t, tc.wantCode, code, stderr.String())
+			for _, out := range tc.wantOut {
+				assert.Contains(t, stdout.String(), out)
+			}
+			assert.Contains(t, stderr.String(), tc.wantStderr)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"io"
+	"sort"
+)
+
+func dumpFrame(out io.Writer, title string, frame []byte) {
+	fmt.Fprintf(out, "%s frame (%d bytes)\n", title, len(frame))
+	fmt.Fprint(out, hex.Dump(frame))
+}
+
+func printResp(out io.Writer, resp *message.Response, c codec) {
+	fmt.Fprintf(out, "HeadLength: %d\n", resp.HeadLength)
+	fmt.Fprintf(out, "BodyLength: %d\n", resp.BodyLength)
+	fmt.Fprintf(out, "RequestID:  %d\n", resp.RequestID)
+	fmt.Fprintf(out, "Version:    %d\n", resp.Version)
+	fmt.Fprintf(out, "Compresser: %d\n", resp.Compresser)
+	fmt.Fprintf(out, "Serializer: %d\n", resp.Serializer)
+	fmt.Fprintf(out, "Status:     %s\n", status.Code(resp.Status))
+	keys := make([]string, 0, len(resp.Meta))
+	for k := range resp.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(out, "Meta:       %s=%s\n", k, resp.Meta[k])
+	}
+	if len(resp.Error) > 0 {
+		fmt.Fprintf(out, "Error:      %s\n", resp.Error)
+	}
+	if len(resp.Data) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "Data:")
+	data, err := c.toJSON(resp.Data)
+	var buf bytes.Buffer
+	if err == nil {
+		err = json.Indent(&buf, data, "", "  ")
+	}
+	if err != nil {
+		// 无法转换为 JSON 时输出原始数据
+		fmt.Fprint(out, hex.Dump(resp.Data))
+		return
+	}
+	buf.WriteByte('\n')
+	_, _ = buf.WriteTo(out)
+}
+
+// printServices 输出反射服务返回的服务列表
+func printServices(out io.Writer, data []byte) error {
+	var resp mrpc.ListServicesResp
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	for _, service := range resp.Services {
+		fmt.Fprintln(out, service.Name)
+		for _, method := range service.Methods {
+			req, resp := method.Request, method.Response
+			if method.RequestProto != "" {
+				req = method.RequestProto
+			}
+			if method.ResponseProto != "" {
+				resp = method.ResponseProto
+			}
+			fmt.Fprintf(out, "  %s(%s) %s\n", method.Name, req, resp)
+		}
+	}
+	return nil
+}
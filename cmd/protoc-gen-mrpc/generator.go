@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/compiler/protogen"
+	"path"
+)
+
+const (
+	contextPackage   = protogen.GoImportPath("context")
+	mrpcPackage      = protogen.GoImportPath("github.com/NotFound1911/mrpc")
+	serializePackage = protogen.GoImportPath("github.com/NotFound1911/mrpc/serialize/proto")
+)
+
+// generateFile 为 file 中的所有 service 生成代码
+// packageSuffix 不为空时生成到子包中，避免 proto 所在的包依赖 mrpc
+func generateFile(plugin *protogen.Plugin, file *protogen.File, packageSuffix string) error {
+	for _, service := range file.Services {
+		for _, method := range service.Methods {
+			if method.Desc.IsStreamingClient() || method.Desc.IsStreamingServer() {
+				return fmt.Errorf("protoc-gen-mrpc: %s.%s: 不支持流式方法",
+					service.Desc.FullName(), method.Desc.Name())
+			}
+		}
+	}
+
+	filename := file.GeneratedFilenamePrefix + "_mrpc.pb.go"
+	importPath := file.GoImportPath
+	packageName := file.GoPackageName
+	if packageSuffix != "" {
+		packageName += protogen.GoPackageName(packageSuffix)
+		dir, base := path.Split(file.GeneratedFilenamePrefix)
+		filename = path.Join(dir, string(packageName), base+"_mrpc.pb.go")
+		importPath = protogen.GoImportPath(path.Join(string(importPath), string(packageName)))
+	}
+	g := plugin.NewGeneratedFile(filename, importPath)
+	g.P("// Code generated by protoc-gen-mrpc. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", packageName)
+	g.P()
+	for _, service := range file.Services {
+		generateService(g, service)
+	}
+	return nil
+}
+
+func generateService(g *protogen.GeneratedFile, service *protogen.Service) {
+	name := service.GoName
+	nameConst := name + "Name"
+	clientName := name + "Client"
+	serverName := name + "Server"
+	stubName := lowerFirst(name) + "ServerStub"
+
+	g.P("// ", nameConst, " 服务名，由 proto 包名与服务名组成")
+	g.P("const ", nameConst, " = ", fmt.Sprintf("%q", service.Desc.FullName()))
+	g.P()
+
+	// 客户端
+	g.P("// ", clientName, " 通过 mrpc.Client.InitService 初始化后使用")
+	g.P(service.Comments.Leading, "type ", clientName, " struct {")
+	for _, method := range service.Methods {
+		g.P(method.Comments.Leading,
+			method.GoName, " func(ctx ", g.QualifiedGoIdent(contextPackage.Ident("Context")),
+			", req *", g.QualifiedGoIdent(method.Input.GoIdent),
+			") (*", g.QualifiedGoIdent(method.Output.GoIdent), ", error) `mrpc:\"serializer=proto\"`")
+	}
+	g.P("}")
+	g.P()
+	g.P("func (c ", clientName, ") Name() string {")
+	g.P("return ", nameConst)
+	g.P("}")
+	g.P()
+
+	// 服务端
+	g.P("// ", serverName, " 服务端需要实现的接口")
+	g.P("type ", serverName, " interface {")
+	for _, method := range service.Methods {
+		g.P(method.Comments.Leading,
+			method.GoName, "(ctx ", g.QualifiedGoIdent(contextPackage.Ident("Context")),
+			", req *", g.QualifiedGoIdent(method.Input.GoIdent),
+			") (*", g.QualifiedGoIdent(method.Output.GoIdent), ", error)")
+	}
+	g.P("}")
+	g.P()
+	g.P("// ", stubName, " 为实现补充服务名")
+	g.P("type ", stubName, " struct {")
+	g.P(serverName)
+	g.P("}")
+	g.P()
+	g.P("func (s *", stubName, ") Name() string {")
+	g.P("return ", nameConst)
+	g.P("}")
+	g.P()
+	g.P("// Register", serverName, " 注册服务，同时为服务端注册 proto 序列化协议")
+	g.P("func Register", serverName, "(s *", g.QualifiedGoIdent(mrpcPackage.Ident("Server")), ", impl ", serverName, ") error {")
+	g.P("if err := s.RegisterSerializer(&", g.QualifiedGoIdent(serializePackage.Ident("Serializer")), "{}); err != nil {")
+	g.P("return err")
+	g.P("}")
+	g.P("s.RegisterService(&", stubName, "{", serverName, ": impl})")
+	g.P("return nil")
+	g.P("}")
+	g.P()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	b := []byte(s)
+	if b[0] >= 'A' && b[0] <= 'Z' {
+		b[0] += 'a' - 'A'
+	}
+	return string(b)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"github.com/NotFound1911/mrpc/internal/proto/gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "更新 internal/proto/gen/genmrpc 中生成的代码")
+
+const goldenFile = "../../internal/proto/gen/genmrpc/user_mrpc.pb.go"
+
+func generate(t *testing.T, file *descriptorpb.FileDescriptorProto, param string) (*pluginpb.CodeGeneratorResponse, error) {
+	var flags flag.FlagSet
+	packageSuffix := flags.String("package_suffix", "", "")
+	plugin, err := protogen.Options{ParamFunc: flags.Set}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{file.GetName()},
+		Parameter:      proto.String(param),
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{file},
+	})
+	require.NoError(t, err)
+	err = run(plugin, *packageSuffix)
+	return plugin.Response(), err
+}
+
+func TestGenerate(t *testing.T) {
+	file := protodesc.ToFileDescriptorProto(gen.File_user_proto)
+	testCases := []struct {
+		name         string
+		param        string
+		wantFilename string
+	}{
+		{
+			name:         "same package",
+			param:        "Muser.proto=github.com/NotFound1911/mrpc/internal/proto/gen",
+			wantFilename: "github.com/NotFound1911/mrpc/internal/proto/gen/user_mrpc.pb.go",
+		},
+		{
+			name:         "package suffix",
+			param:        "Muser.proto=github.com/NotFound1911/mrpc/internal/proto/gen,package_suffix=mrpc",
+			wantFilename: "github.com/NotFound1911/mrpc/internal/proto/gen/genmrpc/user_mrpc.pb.go",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := generate(t, file, tc.param)
+			require.NoError(t, err)
+			require.Len(t, resp.File, 1)
+			assert.Equal(t, tc.wantFilename, resp.File[0].GetName())
+		})
+	}
+}
+
+// TestGenerate_Golden 生成的代码需要与 internal/proto/gen/genmrpc 中的代码一致
+// 修改生成逻辑后使用 go test -run TestGenerate_Golden -update 更新
+func TestGenerate_Golden(t *testing.T) {
+	resp, err := generate(t, protodesc.ToFileDescriptorProto(gen.File_user_proto),
+		"Muser.proto=github.com/NotFound1911/mrpc/internal/proto/gen,package_suffix=mrpc")
+	require.NoError(t, err)
+	require.Len(t, resp.File, 1)
+	content := resp.File[0].GetContent()
+	if *update {
+		require.NoError(t, os.WriteFile(goldenFile, []byte(content), 0644))
+	}
+	want, err := os.ReadFile(goldenFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), content)
+}
+
+func TestGenerate_Streaming(t *testing.T) {
+	file := protodesc.ToFileDescriptorProto(gen.File_user_proto)
+	file.Service[0].Method[0].ServerStreaming = proto.Bool(true)
+	_, err := generate(t, file, "Muser.proto=github.com/NotFound1911/mrpc/internal/proto/gen")
+	assert.EqualError(t, err, "protoc-gen-mrpc: users.UserService.GetById: 不支持流式方法")
+}
@@ -0,0 +1,42 @@
+// protoc-gen-mrpc 根据 proto 文件中的 service 生成 mrpc 客户端与服务端代码
+//
+// 安装:
+//
+//	go install github.com/NotFound1911/mrpc/cmd/protoc-gen-mrpc@latest
+//
+// 使用:
+//
+//	protoc --go_out=. --mrpc_out=. user.proto
+//
+// 生成的代码默认与 protoc-gen-go 生成的代码位于同一个包
+// 通过 --mrpc_opt=package_suffix=mrpc 可以生成到子包 <包名>mrpc 中
+package main
+
+import (
+	"flag"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func main() {
+	var flags flag.FlagSet
+	packageSuffix := flags.String("package_suffix", "", "生成到子包 <包名><package_suffix> 中")
+	protogen.Options{
+		ParamFunc: flags.Set,
+	}.Run(func(plugin *protogen.Plugin) error {
+		return run(plugin, *packageSuffix)
+	})
+}
+
+func run(plugin *protogen.Plugin, packageSuffix string) error {
+	plugin.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+	for _, f := range plugin.Files {
+		if !f.Generate || len(f.Services) == 0 {
+			continue
+		}
+		if err := generateFile(plugin, f, packageSuffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,44 @@
 package mrpc
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"github.com/NotFound1911/mrpc/message"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metaDeadline = "deadline"
+	metaOneway   = "one-way"
+	// metaSerializers 服务端支持的序列化协议，以逗号分隔
+	metaSerializers = "mrpc-serializers"
+)
+
+// reservedMeta 框架内部使用的元数据，用户不能设置
+var reservedMeta = map[string]struct{}{
+	metaDeadline:    {},
+	metaOneway:      {},
+	metaSerializers: {},
+}
+
+// CheckMeta 校验用户设置的元数据
+// key 不能是框架保留的字段，key 与 value 不能包含协议使用的分隔符
+// 网关等从外部接收元数据的组件需要用它过滤
+func CheckMeta(k, v string) error {
+	if k == "" {
+		return fmt.Errorf("mrpc: 元数据 key 不能为空")
+	}
+	if _, ok := reservedMeta[k]; ok {
+		return fmt.Errorf("mrpc: 元数据 %s 是保留字段", k)
+	}
+	if strings.ContainsAny(k, "\r\n") || strings.ContainsAny(v, "\r\n") {
+		return fmt.Errorf("mrpc: 元数据 %s 包含非法字符", k)
+	}
+	return nil
+}
 
 type onewayKey struct{}
 
@@ -12,3 +50,173 @@ func isOneway(ctx context.Context) bool {
 	oneway, ok := val.(bool)
 	return ok && oneway
 }
+
+type outgoingMetaKey struct{}
+
+// AppendOutgoingMeta 客户端附加元数据，随请求发送到服务端
+// 非法的 key 或 value 会让调用直接返回错误
+func AppendOutgoingMeta(ctx context.Context, k, v string) context.Context {
+	old := outgoingMeta(ctx)
+	meta := make(map[string]string, len(old)+1)
+	for key, val := range old {
+		meta[key] = val
+	}
+	meta[k] = v
+	return context.WithValue(ctx, outgoingMetaKey{}, meta)
+}
+func outgoingMeta(ctx context.Context) map[string]string {
+	meta, _ := ctx.Value(outgoingMetaKey{}).(map[string]string)
+	return meta
+}
+
+// requestMeta 根据 ctx 生成请求的元数据，包含用户设置的元数据、超时时间与 oneway 标记
+func requestMeta(ctx context.Context) (map[string]string, error) {
+	userMeta := outgoingMeta(ctx)
+	meta := make(map[string]string, len(userMeta)+2)
+	for k, v := range userMeta {
+		if err := CheckMeta(k, v); err != nil {
+			return nil, err
+		}
+		meta[k] = v
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		meta[metaDeadline] = strconv.FormatInt(deadline.UnixMilli(), 10)
+	}
+	if isOneway(ctx) {
+		meta[metaOneway] = "true"
+	}
+	return meta, nil
+}
+
+// ctxWithMetaDeadline 按照请求元数据中的超时时间设置 ctx
+func ctxWithMetaDeadline(ctx context.Context, meta map[string]string) (context.Context, context.CancelFunc) {
+	if deadlineStr, ok := meta[metaDeadline]; ok {
+		if deadline, err := strconv.ParseInt(deadlineStr, 10, 64); err == nil {
+			return context.WithDeadline(ctx, time.UnixMilli(deadline))
+		}
+	}
+	return ctx, func() {}
+}
+
+type incomingMetaKey struct{}
+
+func ctxWithIncomingMeta(ctx context.Context, reqMeta map[string]string) context.Context {
+	meta := make(map[string]string, len(reqMeta))
+	for k, v := range reqMeta {
+		if _, ok := reservedMeta[k]; ok {
+			continue
+		}
+		meta[k] = v
+	}
+	return context.WithValue(ctx, incomingMetaKey{}, meta)
+}
+
+// IncomingMeta 服务端获取客户端传递的元数据，不包含保留字段
+func IncomingMeta(ctx context.Context) map[string]string {
+	meta, _ := ctx.Value(incomingMetaKey{}).(map[string]string)
+	res := make(map[string]string, len(meta))
+	for k, v := range meta {
+		res[k] = v
+	}
+	return res
+}
+
+type trailerKey struct{}
+
+// trailerHolder 服务端业务方法设置的响应元数据
+type trailerHolder struct {
+	mutex sync.Mutex
+	meta  map[string]string
+}
+
+func ctxWithTrailer(ctx context.Context) (context.Context, *trailerHolder) {
+	t := &trailerHolder{}
+	return context.WithValue(ctx, trailerKey{}, t), t
+}
+
+// SetTrailer 服务端业务方法设置响应元数据，随响应返回给客户端
+func SetTrailer(ctx context.Context, k, v string) error {
+	t, ok := ctx.Value(trailerKey{}).(*trailerHolder)
+	if !ok {
+		return fmt.Errorf("mrpc: 当前 context 不支持设置 trailer")
+	}
+	if err := CheckMeta(k, v); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.meta == nil {
+		t.meta = make(map[string]string, 4)
+	}
+	t.meta[k] = v
+	return nil
+}
+
+type trailerReceiverKey struct{}
+
+// CtxWithTrailer 客户端接收服务端返回的响应元数据，调用返回后写入 trailer
+func CtxWithTrailer(ctx context.Context, trailer map[string]string) context.Context {
+	return context.WithValue(ctx, trailerReceiverKey{}, trailer)
+}
+func trailerReceiver(ctx context.Context) map[string]string {
+	t, _ := ctx.Value(trailerReceiverKey{}).(map[string]string)
+	return t
+}
+
+type peerKey struct{}
+
+func ctxWithPeer(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, peerKey{}, addr)
+}
+
+// PeerFromCtx 获取对端地址，服务端为客户端地址，客户端为服务端地址
+func PeerFromCtx(ctx context.Context) (string, bool) {
+	addr, ok := ctx.Value(peerKey{}).(string)
+	return addr, ok
+}
+
+type payloadKey struct{}
+
+// Payload 一次调用中解码后的请求与响应，供日志等拦截器使用
+type Payload struct {
+	mutex sync.Mutex
+	req   any
+	resp  any
+	// decodeResp 客户端拦截器返回时响应还没有解码，需要时再解码
+	decodeResp func(data []byte) (any, error)
+}
+
+func ctxWithPayload(ctx context.Context) (context.Context, *Payload) {
+	p := &Payload{}
+	return context.WithValue(ctx, payloadKey{}, p), p
+}
+
+func PayloadFromCtx(ctx context.Context) (*Payload, bool) {
+	p, ok := ctx.Value(payloadKey{}).(*Payload)
+	return p, ok
+}
+
+// Request 返回解码后的请求
+func (p *Payload) Request() any {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.req
+}
+
+// Response 返回解码后的响应，客户端需要传入收到的响应用于解码
+func (p *Payload) Response(resp *message.Response) any {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.resp == nil && p.decodeResp != nil && resp != nil && len(resp.Data) > 0 {
+		if val, err := p.decodeResp(resp.Data); err == nil {
+			p.resp = val
+		}
+	}
+	return p.resp
+}
+
+func (p *Payload) set(req, resp any) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.req, p.resp = req, resp
+}
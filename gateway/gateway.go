@@ -0,0 +1,216 @@
+// Package gateway 将 mrpc 服务以 HTTP/JSON 的形式暴露出去
+//
+// 默认路由为 POST /{service}/{method}，请求体与响应体都是 JSON
+// 以 Mrpc-Meta- 开头的请求头转换为元数据，响应中的元数据以相同的前缀写回响应头
+package gateway
+
+import (
+	encjson "encoding/json"
+	"errors"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/serialize/json"
+	"github.com/NotFound1911/mrpc/status"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MetaHeaderPrefix 元数据对应的 HTTP 头前缀
+const MetaHeaderPrefix = "Mrpc-Meta-"
+
+// defaultMaxBodySize 默认的请求体大小上限
+const defaultMaxBodySize = 4 << 20
+
+type route struct {
+	service string
+	method  string
+}
+
+// Gateway 将 HTTP 请求转换为 mrpc 请求
+// p 通常是 *mrpc.Server，也可以是 *mrpc.Client，此时 Gateway 作为远端服务的代理
+type Gateway struct {
+	p           mrpc.Proxy
+	routes      map[string]route
+	maxBodySize int64
+	serializer  json.Serializer
+}
+
+type Option func(g *Gateway)
+
+// WithRoute 将 httpMethod 与 path 映射到服务的方法
+// 自定义路由优先于默认路由
+func WithRoute(httpMethod, path, service, method string) Option {
+	return func(g *Gateway) {
+		g.routes[routeKey(httpMethod, path)] = route{service: service, method: method}
+	}
+}
+
+// WithMaxBodySize 设置请求体大小上限，默认为 4MB
+func WithMaxBodySize(size int64) Option {
+	return func(g *Gateway) {
+		g.maxBodySize = size
+	}
+}
+
+func New(p mrpc.Proxy, opts ...Option) *Gateway {
+	res := &Gateway{
+		p:           p,
+		routes:      make(map[string]route, 8),
+		maxBodySize: defaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func routeKey(httpMethod, path string) string {
+	return strings.ToUpper(httpMethod) + " " + path
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt, ok := g.routes[routeKey(r.Method, r.URL.Path)]
+	if !ok {
+		rt, ok = defaultRoute(r.URL.Path)
+		if !ok {
+			writeError(w, status.New(status.NotFound, "路由不存在"))
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeErrorCode(w, http.StatusMethodNotAllowed, status.Unimplemented, "只支持 POST 方法")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, g.maxBodySize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeErrorCode(w, http.StatusRequestEntityTooLarge, status.ResourceExhausted, "请求体过大")
+			return
+		}
+		writeError(w, status.New(status.InvalidArgument, err.Error()))
+		return
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+	if !encjson.Valid(body) {
+		writeError(w, status.New(status.InvalidArgument, "请求体不是合法的 JSON"))
+		return
+	}
+
+	meta, err := metaFromHeader(r.Header)
+	if err != nil {
+		writeError(w, status.New(status.InvalidArgument, err.Error()))
+		return
+	}
+	req := &message.Request{
+		ServiceName: rt.service,
+		MethodName:  rt.method,
+		Serializer:  g.serializer.Code(),
+		Meta:        meta,
+		Data:        body,
+	}
+	req.CalHeaderLen()
+	req.CalBodyLen()
+	resp, err := g.p.Invoke(r.Context(), req)
+	if resp != nil {
+		for k, v := range resp.Meta {
+			w.Header().Set(MetaHeaderPrefix+k, v)
+		}
+	}
+	if code := status.ResultCode(resp, err); code != status.OK {
+		msg := status.MessageOf(err)
+		if err == nil {
+			msg = string(resp.Error)
+		}
+		writeError(w, status.New(code, msg))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if len(resp.Data) == 0 {
+		_, _ = w.Write([]byte("{}"))
+		return
+	}
+	_, _ = w.Write(resp.Data)
+}
+
+// defaultRoute 解析 /{service}/{method}
+// 服务名中可以包含 /，最后一段为方法名
+func defaultRoute(path string) (route, bool) {
+	path = strings.TrimPrefix(path, "/")
+	idx := strings.LastIndex(path, "/")
+	if idx <= 0 || idx == len(path)-1 {
+		return route{}, false
+	}
+	return route{service: path[:idx], method: path[idx+1:]}, true
+}
+
+// metaFromHeader 取出 Mrpc-Meta- 开头的请求头
+// 框架保留的元数据（例如 one-way、deadline）不能由 HTTP 调用方设置
+func metaFromHeader(header http.Header) (map[string]string, error) {
+	res := make(map[string]string, 4)
+	for k, vs := range header {
+		if len(vs) == 0 || !strings.HasPrefix(k, MetaHeaderPrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(k, MetaHeaderPrefix))
+		if err := mrpc.CheckMeta(key, vs[0]); err != nil {
+			return nil, err
+		}
+		res[key] = vs[0]
+	}
+	return res, nil
+}
+
+// errorBody 出错时的响应体
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := status.CodeOf(err)
+	writeErrorCode(w, HTTPStatus(code), code, status.MessageOf(err))
+}
+
+func writeErrorCode(w http.ResponseWriter, httpStatus int, code status.Code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_ = encjson.NewEncoder(w).Encode(errorBody{Code: code.String(), Message: msg})
+}
+
+// HTTPStatus 将状态码转换为 HTTP 状态码，与 grpc-gateway 的转换规则一致
+func HTTPStatus(code status.Code) int {
+	switch code {
+	case status.OK:
+		return http.StatusOK
+	case status.Canceled:
+		// 客户端关闭了连接
+		return 499
+	case status.InvalidArgument, status.FailedPrecondition, status.OutOfRange:
+		return http.StatusBadRequest
+	case status.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case status.NotFound:
+		return http.StatusNotFound
+	case status.AlreadyExists, status.Aborted:
+		return http.StatusConflict
+	case status.PermissionDenied:
+		return http.StatusForbidden
+	case status.Unauthenticated:
+		return http.StatusUnauthorized
+	case status.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case status.Unimplemented:
+		return http.StatusNotImplemented
+	case status.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type GetByIdReq struct {
+	Id int `json:"id"`
+}
+
+type GetByIdResp struct {
+	Name string `json:"name"`
+}
+
+type UserServiceServer struct{}
+
+func (u *UserServiceServer) Name() string {
+	return "user-service"
+}
+
+func (u *UserServiceServer) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	switch req.Id {
+	case 0:
+		return nil, status.New(status.InvalidArgument, "id 不能为空")
+	case 404:
+		return nil, status.New(status.NotFound, "用户不存在")
+	case 500:
+		return nil, errors.New("db error")
+	}
+	if tenant, ok := mrpc.IncomingMeta(ctx)["tenant"]; ok {
+		_ = mrpc.SetTrailer(ctx, "tenant", tenant)
+	}
+	return &GetByIdResp{Name: "Tom"}, nil
+}
+
+func TestGateway(t *testing.T) {
+	server := mrpc.NewServer()
+	server.RegisterService(&UserServiceServer{})
+	gw := New(server,
+		WithRoute(http.MethodPut, "/v1/users", "user-service", "GetById"),
+		WithMaxBodySize(64))
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header map[string]string
+
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name:     "ok",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":12}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"name":"Tom"}`,
+		},
+		{
+			name:       "meta",
+			method:     http.MethodPost,
+			path:       "/user-service/GetById",
+			body:       `{"id":12}`,
+			header:     map[string]string{"Mrpc-Meta-Tenant": "a"},
+			wantCode:   http.StatusOK,
+			wantBody:   `{"name":"Tom"}`,
+			wantHeader: map[string]string{"Mrpc-Meta-Tenant": "a"},
+		},
+		{
+			name:     "reserved meta one-way",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":12}`,
+			header:   map[string]string{"Mrpc-Meta-One-Way": "true"},
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"code":"InvalidArgument","message":"mrpc: 元数据 one-way 是保留字段"}`,
+		},
+		{
+			name:     "reserved meta deadline",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":12}`,
+			header:   map[string]string{"Mrpc-Meta-Deadline": "1"},
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"code":"InvalidArgument","message":"mrpc: 元数据 deadline 是保留字段"}`,
+		},
+		{
+			name:     "reserved meta serializers",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":12}`,
+			header:   map[string]string{"Mrpc-Meta-Mrpc-Serializers": "json"},
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"code":"InvalidArgument","message":"mrpc: 元数据 mrpc-serializers 是保留字段"}`,
+		},
+		{
+			name:     "custom route",
+			method:   http.MethodPut,
+			path:     "/v1/users",
+			body:     `{"id":12}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"name":"Tom"}`,
+		},
+		{
+			name:     "empty body",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"code":"InvalidArgument","message":"id 不能为空"}`,
+		},
+		{
+			name:     "status error",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":404}`,
+			wantCode: http.StatusNotFound,
+			wantBody: `{"code":"NotFound","message":"用户不存在"}`,
+		},
+		{
+			name:     "plain error",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":500}`,
+			wantCode: http.StatusInternalServerError,
+			wantBody: `{"code":"Unknown","message":"db error"}`,
+		},
+		{
+			name:     "invalid json",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"code":"InvalidArgument","message":"请求体不是合法的 JSON"}`,
+		},
+		{
+			name:     "body too large",
+			method:   http.MethodPost,
+			path:     "/user-service/GetById",
+			body:     `{"id":12,"padding":"` + strings.Repeat("a", 64) + `"}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantBody: `{"code":"ResourceExhausted","message":"请求体过大"}`,
+		},
+		{
+			name:     "method not allowed",
+			method:   http.MethodGet,
+			path:     "/user-service/GetById",
+			wantCode: http.StatusMethodNotAllowed,
+			wantBody: `{"code":"Unimplemented","message":"只支持 POST 方法"}`,
+		},
+		{
+			name:     "unknown service",
+			method:   http.MethodPost,
+			path:     "/order-service/GetById",
+			wantCode: http.StatusNotImplemented,
+			wantBody: `{"code":"Unimplemented","message":"调用的服务不存在"}`,
+		},
+		{
+			name:     "unknown method",
+			method:   http.MethodPost,
+			path:     "/user-service/Name",
+			wantCode: http.StatusNotImplemented,
+			wantBody: `{"code":"Unimplemented","message":"调用的方法不存在"}`,
+		},
+		{
+			name:     "no route",
+			method:   http.MethodPost,
+			path:     "/user-service",
+			wantCode: http.StatusNotFound,
+			wantBody: `{"code":"NotFound","message":"路由不存在"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			gw.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.JSONEq(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, recorder.Header().Get(k))
+			}
+		})
+	}
+}
+
+func TestGateway_Client(t *testing.T) {
+	server := mrpc.NewServer()
+	server.RegisterService(&UserServiceServer{})
+	go func() {
+		err := server.Start("tcp", ":8095")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+	client, err := mrpc.NewClient(":8095")
+	require.NoError(t, err)
+	// 作为远端服务的代理
+	httpServer := httptest.NewServer(New(client))
+	defer httpServer.Close()
+
+	resp, err := http.Post(httpServer.URL+"/user-service/GetById", "application/json", strings.NewReader(`{"id":404}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -1,20 +1,18 @@
 module github.com/NotFound1911/mrpc
 
-go 1.20
+go 1.21
 
 require (
 	github.com/golang/mock v1.6.0
-	github.com/silenceper/pool v1.0.0
 	github.com/stretchr/testify v1.8.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/sirupsen/logrus v1.4.2 // indirect
-	golang.org/x/sys v0.13.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	google.golang.org/genproto v0.0.0-20231212172506-995d672761c0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
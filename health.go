@@ -0,0 +1,260 @@
+package mrpc
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthServiceName 健康检查服务的服务名
+const HealthServiceName = "mrpc.health"
+
+// HealthStatus 服务的健康状态
+type HealthStatus string
+
+const (
+	HealthUnknown    HealthStatus = "UNKNOWN"
+	HealthServing    HealthStatus = "SERVING"
+	HealthNotServing HealthStatus = "NOT_SERVING"
+	// HealthDraining 服务端正在关闭，不再接收新的请求
+	HealthDraining HealthStatus = "DRAINING"
+)
+
+const (
+	// maxHealthWatchTimeout Watch 最长的等待时间
+	maxHealthWatchTimeout = 30 * time.Second
+	// healthWatchTimeout 客户端每次 Watch 的等待时间
+	healthWatchTimeout = 10 * time.Second
+	// minHealthRetryInterval 与 maxHealthRetryInterval Watch 出错或者服务端正在关闭时的重试间隔
+	// 重试间隔每次翻倍，收到其他状态后重置
+	minHealthRetryInterval = 100 * time.Millisecond
+	maxHealthRetryInterval = 5 * time.Second
+)
+
+// ServerWithHealth 注册健康检查服务
+// 空字符串表示整个服务端的状态，服务端启动后为 SERVING
+// 注册的服务默认为 SERVING，可以通过 Server.SetServingStatus 修改，Shutdown 时全部变为 DRAINING
+func ServerWithHealth() ServerOption {
+	return func(server *Server) {
+		server.RegisterService(&healthService{health: server.health})
+	}
+}
+
+type HealthCheckReq struct {
+	// Service 服务名，为空时检查整个服务端
+	Service string
+}
+
+type HealthCheckResp struct {
+	Status HealthStatus
+}
+
+type HealthWatchReq struct {
+	Service string
+	// Status 客户端已知的状态，状态与之不同时立刻返回
+	Status HealthStatus
+	// Timeout 状态没有变化时最长的等待时间，超时后返回当前状态
+	Timeout time.Duration
+}
+
+// healthState 保存服务的健康状态，状态变化时通知等待者
+type healthState struct {
+	mutex    sync.RWMutex
+	statuses map[string]HealthStatus
+	// changed 状态变化时关闭并替换
+	changed chan struct{}
+}
+
+func newHealthState() *healthState {
+	return &healthState{
+		statuses: map[string]HealthStatus{"": HealthServing},
+		changed:  make(chan struct{}),
+	}
+}
+
+func (h *healthState) get(service string) (HealthStatus, <-chan struct{}) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	st, ok := h.statuses[service]
+	if !ok {
+		st = HealthUnknown
+	}
+	return st, h.changed
+}
+
+func (h *healthState) set(service string, st HealthStatus) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.statuses[service] == st {
+		return
+	}
+	h.statuses[service] = st
+	h.notify()
+}
+
+// drain 将所有服务标记为 DRAINING
+func (h *healthState) drain() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for service := range h.statuses {
+		h.statuses[service] = HealthDraining
+	}
+	h.notify()
+}
+
+func (h *healthState) notify() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+type healthService struct {
+	health *healthState
+}
+
+func (h *healthService) Name() string {
+	return HealthServiceName
+}
+
+func (h *healthService) Check(ctx context.Context, req *HealthCheckReq) (*HealthCheckResp, error) {
+	st, _ := h.health.get(req.Service)
+	if st == HealthUnknown {
+		return nil, status.Errorf(status.NotFound, "服务 %s 不存在", req.Service)
+	}
+	return &HealthCheckResp{Status: st}, nil
+}
+
+// Watch 长轮询，状态与 req.Status 不同或者等待超时后返回当前状态
+// 服务端关闭时不再等待，避免 Shutdown 等待长轮询结束
+func (h *healthService) Watch(ctx context.Context, req *HealthWatchReq) (*HealthCheckResp, error) {
+	timeout := req.Timeout
+	if timeout <= 0 || timeout > maxHealthWatchTimeout {
+		timeout = maxHealthWatchTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		st, changed := h.health.get(req.Service)
+		if st != req.Status || st == HealthDraining {
+			return &HealthCheckResp{Status: st}, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return &HealthCheckResp{Status: st}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SetServingStatus 修改服务的健康状态，service 为空时修改整个服务端的状态
+func (s *Server) SetServingStatus(service string, st HealthStatus) {
+	s.health.set(service, st)
+}
+
+// healthClient 健康检查服务的客户端
+type healthClient struct {
+	Check func(ctx context.Context, req *HealthCheckReq) (*HealthCheckResp, error) `mrpc:"serializer=json"`
+	Watch func(ctx context.Context, req *HealthWatchReq) (*HealthCheckResp, error) `mrpc:"serializer=json"`
+}
+
+func (h healthClient) Name() string {
+	return HealthServiceName
+}
+
+// ClientWithHealthCheck 通过服务端的健康检查服务监听服务端状态
+// 服务端状态为 NOT_SERVING 或者 DRAINING 时，调用直接返回 Unavailable
+func ClientWithHealthCheck() ClientOption {
+	return func(client *Client) {
+		client.healthCheck = true
+	}
+}
+
+// CheckHealth 查询服务的健康状态，service 为空时查询整个服务端
+func (c *Client) CheckHealth(ctx context.Context, service string) (HealthStatus, error) {
+	stub := &healthClient{}
+	if err := c.InitService(stub); err != nil {
+		return HealthUnknown, err
+	}
+	resp, err := stub.Check(ctx, &HealthCheckReq{Service: service})
+	if err != nil {
+		return HealthUnknown, err
+	}
+	return resp.Status, nil
+}
+
+// healthWatcher 在后台监听服务端的状态
+type healthWatcher struct {
+	status atomic.Pointer[HealthStatus]
+	cancel context.CancelFunc
+}
+
+func (c *Client) watchHealth() error {
+	stub := &healthClient{}
+	if err := c.InitService(stub); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &healthWatcher{cancel: cancel}
+	st := HealthUnknown
+	w.set(st)
+	c.health = w
+	go func() {
+		retry := minHealthRetryInterval
+		backoff := func() {
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+			}
+			retry = min(retry*2, maxHealthRetryInterval)
+		}
+		for ctx.Err() == nil {
+			watchCtx, watchCancel := context.WithTimeout(ctx, healthWatchTimeout+5*time.Second)
+			resp, err := stub.Watch(watchCtx, &HealthWatchReq{Status: st, Timeout: healthWatchTimeout})
+			watchCancel()
+			if err != nil {
+				if status.CodeOf(err) == status.Unimplemented {
+					// 服务端没有健康检查服务，可能是同一地址上重新启动的其他服务端，不再限制调用
+					w.set(HealthUnknown)
+					return
+				}
+				// 连接出错时不改变状态，由调用本身报错
+				if st == HealthDraining {
+					// 关闭中的服务端返还的连接也会陆续失效
+					c.pool.CloseIdle()
+				}
+				backoff()
+				continue
+			}
+			st = resp.Status
+			w.set(st)
+			if st == HealthDraining {
+				// 服务端正在关闭，空闲连接都会失效
+				// Watch 会立即返回，同一地址上可能会启动新的服务端，继续低频轮询
+				c.pool.CloseIdle()
+				backoff()
+				continue
+			}
+			retry = minHealthRetryInterval
+		}
+	}()
+	return nil
+}
+
+// set 保存状态的副本，调用方读取时 watch 协程可能正在修改自己的变量
+func (w *healthWatcher) set(st HealthStatus) {
+	w.status.Store(&st)
+}
+
+// checkHealth 服务端明确表示不可用时返回错误
+func (w *healthWatcher) checkHealth() error {
+	if w == nil {
+		return nil
+	}
+	if st := *w.status.Load(); st == HealthNotServing || st == HealthDraining {
+		return status.Errorf(status.Unavailable, "服务端状态为 %s", st)
+	}
+	return nil
+}
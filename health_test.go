@@ -0,0 +1,136 @@
+package mrpc
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	server := NewServer(ServerWithHealth())
+	server.RegisterService(&UserServiceServer{Msg: "hello"})
+	go func() {
+		err := server.Start("tcp", ":8099")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	client, err := NewClient(":8099", ClientWithHealthCheck())
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+
+	testCases := []struct {
+		name    string
+		service string
+
+		wantStatus HealthStatus
+		wantErr    error
+	}{
+		{
+			name:       "server",
+			wantStatus: HealthServing,
+		},
+		{
+			name:       "service",
+			service:    "user-service",
+			wantStatus: HealthServing,
+		},
+		{
+			name:       "unknown service",
+			service:    "order-service",
+			wantStatus: HealthUnknown,
+			wantErr:    status.New(status.NotFound, "服务 order-service 不存在"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			st, err := client.CheckHealth(ctx, tc.service)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantStatus, st)
+		})
+	}
+
+	call := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := usClient.GetById(ctx, &GetByIdReq{Id: 1})
+		return err
+	}
+	require.NoError(t, call())
+
+	// 服务端不可用时客户端直接返回 Unavailable
+	server.SetServingStatus("", HealthNotServing)
+	assert.Eventually(t, func() bool {
+		return status.CodeOf(call()) == status.Unavailable
+	}, time.Second, 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	st, err := client.CheckHealth(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, HealthNotServing, st)
+
+	server.SetServingStatus("", HealthServing)
+	assert.Eventually(t, func() bool {
+		return call() == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	server := NewServer(ServerWithHealth())
+	service := &UserServiceServerTimeout{t: t, sleep: 500 * time.Millisecond, Msg: "hello"}
+	server.RegisterService(service)
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- server.Start("tcp", ":8100")
+	}()
+	time.Sleep(time.Second)
+
+	client, err := NewClient(":8100", ClientWithHealthCheck())
+	require.NoError(t, err)
+	defer client.Close()
+	usClient := &UserService{}
+	require.NoError(t, client.InitService(usClient))
+
+	// 正在处理的请求不受影响
+	callErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+		_, err := usClient.GetById(ctx, &GetByIdReq{Id: 1})
+		callErr <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+	assert.Equal(t, ErrServerClosed, <-startErr)
+	assert.NoError(t, <-callErr)
+
+	// 客户端感知到 DRAINING 后直接失败
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = usClient.GetById(ctx, &GetByIdReq{Id: 1})
+	assert.Equal(t, status.New(status.Unavailable, "服务端状态为 DRAINING"), err)
+
+	// 同一地址上启动新的服务端之后恢复
+	server = NewServer(ServerWithHealth())
+	server.RegisterService(&UserServiceServerTimeout{t: t, Msg: "hello"})
+	go func() {
+		err := server.Start("tcp", ":8100")
+		t.Log("err:", err)
+	}()
+	assert.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := usClient.GetById(ctx, &GetByIdReq{Id: 1})
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond)
+}
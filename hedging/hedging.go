@@ -0,0 +1,171 @@
+// Package hedging 实现对冲请求
+//
+// 幂等的调用在配置的延迟之后仍然没有返回时，将同样的请求发送到其他实例，采用最先成功的响应并取消其余请求
+package hedging
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"sync/atomic"
+	"time"
+)
+
+type config struct {
+	delay       time.Duration
+	percentile  float64
+	maxAttempts int
+	idempotent  func(service, method string) bool
+}
+
+type Option func(c *config)
+
+// WithDelay 固定的对冲延迟，默认为 100ms
+// 同时设置了 WithPercentile 时，在样本不足之前使用该延迟
+func WithDelay(delay time.Duration) Option {
+	return func(c *config) {
+		c.delay = delay
+	}
+}
+
+// WithPercentile 使用最近调用耗时的分位数作为对冲延迟，例如 0.95
+func WithPercentile(p float64) Option {
+	return func(c *config) {
+		c.percentile = p
+	}
+}
+
+// WithMaxAttempts 最多发送的请求数，包含第一次请求，默认为 2
+func WithMaxAttempts(n int) Option {
+	return func(c *config) {
+		c.maxAttempts = n
+	}
+}
+
+// WithIdempotent 判断方法是否幂等，只有幂等的方法才会对冲
+func WithIdempotent(fn func(service, method string) bool) Option {
+	return func(c *config) {
+		c.idempotent = fn
+	}
+}
+
+// WithIdempotentMethods 声明幂等的方法，格式为 service.method
+func WithIdempotentMethods(methods ...string) Option {
+	set := make(map[string]struct{}, len(methods))
+	for _, m := range methods {
+		set[m] = struct{}{}
+	}
+	return WithIdempotent(func(service, method string) bool {
+		_, ok := set[service+"."+method]
+		return ok
+	})
+}
+
+// result 一次尝试的结果
+type result struct {
+	resp *message.Response
+	err  error
+}
+
+// final 是否可以直接作为调用结果
+// 服务端不可用或者连接出错时等待其他尝试
+func (r result) final() bool {
+	return r.err == nil && status.ResultCode(r.resp, nil) != status.Unavailable
+}
+
+// Interceptor 返回客户端拦截器
+// 第一次请求由当前客户端发出，对冲请求依次发送到 instances，通常是连接到同一服务其他地址的 *mrpc.Client
+func Interceptor(instances []mrpc.Proxy, opts ...Option) mrpc.Interceptor {
+	cfg := &config{
+		delay:       100 * time.Millisecond,
+		maxAttempts: 2,
+		idempotent: func(service, method string) bool {
+			return false
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.maxAttempts > len(instances)+1 {
+		cfg.maxAttempts = len(instances) + 1
+	}
+	latency := newLatencyWindow(latencyWindowSize)
+	// next 用于在 instances 之间轮转
+	var next atomic.Uint32
+	return func(handler mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			if cfg.maxAttempts < 2 || !cfg.idempotent(req.ServiceName, req.MethodName) {
+				return handler(ctx, req)
+			}
+			delay := cfg.delay
+			if cfg.percentile > 0 {
+				if d, ok := latency.percentile(cfg.percentile); ok {
+					delay = d
+				}
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			// 返回时取消其余的请求
+			defer cancel()
+			results := make(chan result, cfg.maxAttempts)
+			attempt := func(invoke mrpc.HandleFunc, req *message.Request) {
+				start := time.Now()
+				resp, err := invoke(ctx, req)
+				if err == nil {
+					latency.add(time.Since(start))
+				}
+				results <- result{resp: resp, err: err}
+			}
+			// 第一次请求发出后可能被修改，先复制一份用于对冲
+			template := cloneRequest(req)
+			go attempt(handler, req)
+			attempts, pending := 1, 1
+			offset := int(next.Add(1) - 1)
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			var first *result
+			for {
+				select {
+				case r := <-results:
+					pending--
+					if r.final() {
+						return r.resp, r.err
+					}
+					if first == nil {
+						first = &r
+					}
+					if attempts < cfg.maxAttempts {
+						// 失败时不再等待，立刻发送下一个请求
+						timer.Reset(0)
+					} else if pending == 0 {
+						return first.resp, first.err
+					}
+				case <-timer.C:
+					if attempts >= cfg.maxAttempts {
+						continue
+					}
+					instance := instances[(offset+attempts-1)%len(instances)]
+					go attempt(instance.Invoke, cloneRequest(template))
+					attempts++
+					pending++
+					if attempts < cfg.maxAttempts {
+						timer.Reset(delay)
+					}
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// cloneRequest 复制请求，请求 ID 由发送的客户端重新分配
+func cloneRequest(req *message.Request) *message.Request {
+	res := *req
+	res.RequestID = 0
+	res.Meta = make(map[string]string, len(req.Meta))
+	for k, v := range req.Meta {
+		res.Meta[k] = v
+	}
+	return &res
+}
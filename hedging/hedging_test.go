@@ -0,0 +1,165 @@
+package hedging
+
+import (
+	"context"
+	"errors"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// instance 模拟一个实例，等待 delay 之后返回 resp 和 err
+type instance struct {
+	delay    time.Duration
+	resp     *message.Response
+	err      error
+	calls    atomic.Int32
+	canceled atomic.Int32
+}
+
+func (i *instance) Invoke(ctx context.Context, req *message.Request) (*message.Response, error) {
+	i.calls.Add(1)
+	select {
+	case <-time.After(i.delay):
+		return i.resp, i.err
+	case <-ctx.Done():
+		i.canceled.Add(1)
+		return nil, ctx.Err()
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	testCases := []struct {
+		name      string
+		primary   *instance
+		instances []*instance
+		opts      []Option
+		method    string
+
+		wantResp  *message.Response
+		wantErr   error
+		wantCalls []int32
+	}{
+		{
+			name:      "not idempotent",
+			primary:   &instance{delay: 50 * time.Millisecond, resp: &message.Response{Data: []byte("primary")}},
+			instances: []*instance{{resp: &message.Response{Data: []byte("backup")}}},
+			method:    "Update",
+			wantResp:  &message.Response{Data: []byte("primary")},
+			wantCalls: []int32{1, 0},
+		},
+		{
+			name:      "fast primary",
+			primary:   &instance{resp: &message.Response{Data: []byte("primary")}},
+			instances: []*instance{{resp: &message.Response{Data: []byte("backup")}}},
+			method:    "GetById",
+			wantResp:  &message.Response{Data: []byte("primary")},
+			wantCalls: []int32{1, 0},
+		},
+		{
+			name:      "slow primary",
+			primary:   &instance{delay: time.Second, resp: &message.Response{Data: []byte("primary")}},
+			instances: []*instance{{resp: &message.Response{Data: []byte("backup")}}},
+			method:    "GetById",
+			wantResp:  &message.Response{Data: []byte("backup")},
+			wantCalls: []int32{1, 1},
+		},
+		{
+			name:    "business error is final",
+			primary: &instance{resp: &message.Response{Status: uint8(status.NotFound), Error: []byte("not found")}},
+			instances: []*instance{
+				{resp: &message.Response{Data: []byte("backup")}},
+			},
+			method:    "GetById",
+			wantResp:  &message.Response{Status: uint8(status.NotFound), Error: []byte("not found")},
+			wantCalls: []int32{1, 0},
+		},
+		{
+			name:    "primary failed",
+			primary: &instance{err: errors.New("connection refused")},
+			instances: []*instance{
+				{delay: 10 * time.Millisecond, resp: &message.Response{Data: []byte("backup")}},
+			},
+			opts:      []Option{WithDelay(time.Second)},
+			method:    "GetById",
+			wantResp:  &message.Response{Data: []byte("backup")},
+			wantCalls: []int32{1, 1},
+		},
+		{
+			name:    "all failed",
+			primary: &instance{err: errors.New("primary")},
+			instances: []*instance{
+				{err: errors.New("backup")},
+			},
+			method:    "GetById",
+			wantErr:   errors.New("primary"),
+			wantCalls: []int32{1, 1},
+		},
+		{
+			name:    "max attempts",
+			primary: &instance{delay: time.Second},
+			instances: []*instance{
+				{delay: time.Second},
+				{delay: 10 * time.Millisecond, resp: &message.Response{Data: []byte("backup2")}},
+			},
+			opts:      []Option{WithDelay(10 * time.Millisecond), WithMaxAttempts(3)},
+			method:    "GetById",
+			wantResp:  &message.Response{Data: []byte("backup2")},
+			wantCalls: []int32{1, 1, 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxies := make([]mrpc.Proxy, 0, len(tc.instances))
+			for _, i := range tc.instances {
+				proxies = append(proxies, i)
+			}
+			opts := append([]Option{
+				WithDelay(20 * time.Millisecond),
+				WithIdempotentMethods("user-service.GetById"),
+			}, tc.opts...)
+			handler := Interceptor(proxies, opts...)(tc.primary.Invoke)
+			resp, err := handler(context.Background(), &message.Request{
+				RequestID:   1,
+				ServiceName: "user-service",
+				MethodName:  tc.method,
+				Meta:        map[string]string{},
+			})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantResp, resp)
+			calls := []int32{tc.primary.calls.Load()}
+			for _, i := range tc.instances {
+				calls = append(calls, i.calls.Load())
+			}
+			assert.Equal(t, tc.wantCalls, calls)
+			// 输掉的慢请求都被取消
+			assert.Eventually(t, func() bool {
+				for _, i := range append([]*instance{tc.primary}, tc.instances...) {
+					if i.delay >= time.Second && i.canceled.Load() != i.calls.Load() {
+						return false
+					}
+				}
+				return true
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	w := newLatencyWindow(latencyWindowSize)
+	_, ok := w.percentile(0.9)
+	assert.False(t, ok)
+	for i := 1; i <= latencyWindowSize+100; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	// 只保留最近的 128 个样本：101ms ~ 228ms
+	d, ok := w.percentile(0.5)
+	assert.True(t, ok)
+	assert.Equal(t, 164*time.Millisecond, d)
+	d, _ = w.percentile(1)
+	assert.Equal(t, 228*time.Millisecond, d)
+}
@@ -0,0 +1,65 @@
+// Code generated by mrpcgen. DO NOT EDIT.
+// Source: user.go
+
+package user
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gen "github.com/NotFound1911/mrpc/internal/proto/gen"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockUserService is a mock of UserService interface.
+type MockUserService struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserServiceMockRecorder
+}
+
+// MockUserServiceMockRecorder is the mock recorder for MockUserService.
+type MockUserServiceMockRecorder struct {
+	mock *MockUserService
+}
+
+// NewMockUserService creates a new mock instance.
+func NewMockUserService(ctrl *gomock.Controller) *MockUserService {
+	mock := &MockUserService{ctrl: ctrl}
+	mock.recorder = &MockUserServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserService) EXPECT() *MockUserServiceMockRecorder {
+	return m.recorder
+}
+
+// GetById mocks base method.
+func (m *MockUserService) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetById", ctx, req)
+	ret0, _ := ret[0].(*GetByIdResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetById indicates an expected call of GetById.
+func (mr *MockUserServiceMockRecorder) GetById(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetById", reflect.TypeOf((*MockUserService)(nil).GetById), ctx, req)
+}
+
+// GetByIdProto mocks base method.
+func (m *MockUserService) GetByIdProto(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByIdProto", ctx, req)
+	ret0, _ := ret[0].(*gen.GetByIdResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByIdProto indicates an expected call of GetByIdProto.
+func (mr *MockUserServiceMockRecorder) GetByIdProto(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByIdProto", reflect.TypeOf((*MockUserService)(nil).GetByIdProto), ctx, req)
+}
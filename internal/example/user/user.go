@@ -0,0 +1,21 @@
+// Package user 演示 mrpcgen 的使用方式，生成的代码见 userservice_mrpc.gen.go 与 mock_userservice_mrpc_test.go
+package user
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/internal/proto/gen"
+)
+
+//go:generate go run github.com/NotFound1911/mrpc/cmd/mrpcgen -type UserService -service user-service
+type UserService interface {
+	GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+	GetByIdProto(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error)
+}
+
+type GetByIdReq struct {
+	Id int
+}
+
+type GetByIdResp struct {
+	Msg string
+}
@@ -0,0 +1,46 @@
+package user
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/internal/proto/gen"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestUserService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	impl := NewMockUserService(ctrl)
+	impl.EXPECT().GetById(gomock.Any(), &GetByIdReq{Id: 12}).Return(&GetByIdResp{Msg: "hello"}, nil)
+	impl.EXPECT().GetByIdProto(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) {
+			return &gen.GetByIdResp{User: &gen.User{Id: req.Id}}, nil
+		})
+
+	server := mrpc.NewServer()
+	RegisterUserServiceServer(server, impl)
+	go func() {
+		err := server.Start("tcp", ":8094")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	client, err := mrpc.NewClient(":8094")
+	require.NoError(t, err)
+	us, err := NewUserServiceClient(client)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := us.GetById(ctx, &GetByIdReq{Id: 12})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Msg)
+
+	protoResp, err := us.GetByIdProto(ctx, &gen.GetByIdReq{Id: 13})
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), protoResp.User.Id)
+}
@@ -0,0 +1,58 @@
+// Code generated by mrpcgen. DO NOT EDIT.
+// source: user.go
+
+package user
+
+import (
+	context "context"
+	mrpc "github.com/NotFound1911/mrpc"
+	gen "github.com/NotFound1911/mrpc/internal/proto/gen"
+)
+
+// UserServiceName 服务名
+const UserServiceName = "user-service"
+
+// UserServiceClient 通过 mrpc.Client.InitService 初始化后使用
+type UserServiceClient struct {
+	GetById      func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+	GetByIdProto func(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error)
+}
+
+func (c UserServiceClient) Name() string {
+	return UserServiceName
+}
+
+// NewUserServiceClient 初始化客户端，返回的结果实现了 UserService
+func NewUserServiceClient(c *mrpc.Client) (UserService, error) {
+	stub := &UserServiceClient{}
+	if err := c.InitService(stub); err != nil {
+		return nil, err
+	}
+	return userServiceClient{stub: stub}, nil
+}
+
+type userServiceClient struct {
+	stub *UserServiceClient
+}
+
+func (c userServiceClient) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	return c.stub.GetById(ctx, req)
+}
+
+func (c userServiceClient) GetByIdProto(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) {
+	return c.stub.GetByIdProto(ctx, req)
+}
+
+// userServiceServerStub 为实现补充服务名
+type userServiceServerStub struct {
+	UserService
+}
+
+func (s *userServiceServerStub) Name() string {
+	return UserServiceName
+}
+
+// RegisterUserServiceServer 注册服务
+func RegisterUserServiceServer(s *mrpc.Server, impl UserService) {
+	s.RegisterService(&userServiceServerStub{UserService: impl})
+}
@@ -0,0 +1,46 @@
+// Code generated by protoc-gen-mrpc. DO NOT EDIT.
+// source: user.proto
+
+package genmrpc
+
+import (
+	context "context"
+	mrpc "github.com/NotFound1911/mrpc"
+	gen "github.com/NotFound1911/mrpc/internal/proto/gen"
+	proto "github.com/NotFound1911/mrpc/serialize/proto"
+)
+
+// UserServiceName 服务名，由 proto 包名与服务名组成
+const UserServiceName = "users.UserService"
+
+// UserServiceClient 通过 mrpc.Client.InitService 初始化后使用
+type UserServiceClient struct {
+	GetById func(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) `mrpc:"serializer=proto"`
+}
+
+func (c UserServiceClient) Name() string {
+	return UserServiceName
+}
+
+// UserServiceServer 服务端需要实现的接口
+type UserServiceServer interface {
+	GetById(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error)
+}
+
+// userServiceServerStub 为实现补充服务名
+type userServiceServerStub struct {
+	UserServiceServer
+}
+
+func (s *userServiceServerStub) Name() string {
+	return UserServiceName
+}
+
+// RegisterUserServiceServer 注册服务，同时为服务端注册 proto 序列化协议
+func RegisterUserServiceServer(s *mrpc.Server, impl UserServiceServer) error {
+	if err := s.RegisterSerializer(&proto.Serializer{}); err != nil {
+		return err
+	}
+	s.RegisterService(&userServiceServerStub{UserServiceServer: impl})
+	return nil
+}
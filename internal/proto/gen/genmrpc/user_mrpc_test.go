@@ -0,0 +1,42 @@
+package genmrpc
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/internal/proto/gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type userServer struct{}
+
+func (u *userServer) GetById(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) {
+	return &gen.GetByIdResp{
+		User: &gen.User{Id: req.Id, Name: "Tom"},
+	}, nil
+}
+
+func TestUserService(t *testing.T) {
+	server := mrpc.NewServer()
+	require.NoError(t, RegisterUserServiceServer(server, &userServer{}))
+	go func() {
+		err := server.Start("tcp", ":8093")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	// 客户端默认使用 json，生成的字段通过标签切换到 proto
+	client, err := mrpc.NewClient(":8093")
+	require.NoError(t, err)
+	usClient := &UserServiceClient{}
+	require.NoError(t, client.InitService(usClient))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := usClient.GetById(ctx, &gen.GetByIdReq{Id: 12})
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), resp.User.Id)
+	assert.Equal(t, "Tom", resp.User.Name)
+}
@@ -0,0 +1,170 @@
+package mrpc
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/status"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxRecentErrors 保留的最近错误数量
+const maxRecentErrors = 64
+
+// ServerSnapshot 服务端当前的运行状态，用于排查问题
+type ServerSnapshot struct {
+	Services     []ServiceInfo
+	Conns        []ConnInfo
+	Inflight     []InflightInfo
+	Serializers  []SerializerInfo
+	RecentErrors []ErrorInfo
+}
+
+type ConnInfo struct {
+	Peer     string
+	Since    time.Time
+	Age      time.Duration
+	Requests int64
+}
+
+type InflightInfo struct {
+	RequestID uint32
+	Service   string
+	Method    string
+	Peer      string
+	Start     time.Time
+	Elapsed   time.Duration
+}
+
+type SerializerInfo struct {
+	Name string
+	Code uint8
+}
+
+type ErrorInfo struct {
+	Time    time.Time
+	Service string
+	Method  string
+	Peer    string
+	Code    string
+	Message string
+}
+
+// serverConn 服务端的连接
+type serverConn struct {
+	peer     string
+	since    time.Time
+	requests atomic.Int64
+}
+
+// inflightCall 正在处理的请求
+type inflightCall struct {
+	requestID uint32
+	service   string
+	method    string
+	peer      string
+	start     time.Time
+}
+
+// serverStats 记录正在处理的请求与最近的错误
+type serverStats struct {
+	mutex    sync.Mutex
+	inflight map[*inflightCall]struct{}
+	// errors 环形缓冲，next 为下一个写入的位置
+	errors []ErrorInfo
+	next   int
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		inflight: make(map[*inflightCall]struct{}, 16),
+		errors:   make([]ErrorInfo, 0, maxRecentErrors),
+	}
+}
+
+func (s *serverStats) begin(ctx context.Context, service, method string, requestID uint32) *inflightCall {
+	peer, _ := PeerFromCtx(ctx)
+	call := &inflightCall{
+		requestID: requestID,
+		service:   service,
+		method:    method,
+		peer:      peer,
+		start:     time.Now(),
+	}
+	s.mutex.Lock()
+	s.inflight[call] = struct{}{}
+	s.mutex.Unlock()
+	return call
+}
+
+func (s *serverStats) end(call *inflightCall, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.inflight, call)
+	if err == nil {
+		return
+	}
+	info := ErrorInfo{
+		Time:    time.Now(),
+		Service: call.service,
+		Method:  call.method,
+		Peer:    call.peer,
+		Code:    status.CodeOf(err).String(),
+		Message: status.MessageOf(err),
+	}
+	if len(s.errors) < maxRecentErrors {
+		s.errors = append(s.errors, info)
+	} else {
+		s.errors[s.next] = info
+	}
+	s.next = (s.next + 1) % maxRecentErrors
+}
+
+// Snapshot 返回服务端当前的运行状态
+func (s *Server) Snapshot() *ServerSnapshot {
+	now := time.Now()
+	res := &ServerSnapshot{
+		Services: s.serviceInfos(&fileCollector{seen: map[string]struct{}{}}),
+	}
+
+	s.mutex.Lock()
+	for _, conn := range s.conns {
+		res.Conns = append(res.Conns, ConnInfo{
+			Peer:     conn.peer,
+			Since:    conn.since,
+			Age:      now.Sub(conn.since),
+			Requests: conn.requests.Load(),
+		})
+	}
+	s.mutex.Unlock()
+	sort.Slice(res.Conns, func(i, j int) bool {
+		return res.Conns[i].Since.Before(res.Conns[j].Since)
+	})
+
+	s.stats.mutex.Lock()
+	for call := range s.stats.inflight {
+		res.Inflight = append(res.Inflight, InflightInfo{
+			RequestID: call.requestID,
+			Service:   call.service,
+			Method:    call.method,
+			Peer:      call.peer,
+			Start:     call.start,
+			Elapsed:   now.Sub(call.start),
+		})
+	}
+	// 按时间从新到旧输出
+	n := len(s.stats.errors)
+	for i := 1; i <= n; i++ {
+		res.RecentErrors = append(res.RecentErrors, s.stats.errors[(s.stats.next-i+n)%n])
+	}
+	s.stats.mutex.Unlock()
+	sort.Slice(res.Inflight, func(i, j int) bool {
+		return res.Inflight[i].Start.Before(res.Inflight[j].Start)
+	})
+
+	for _, sl := range s.registry.Serializers() {
+		res.Serializers = append(res.Serializers, SerializerInfo{Name: sl.Name(), Code: sl.Code()})
+	}
+	return res
+}
@@ -0,0 +1,27 @@
+package mrpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestServerStats_RecentErrors(t *testing.T) {
+	stats := newServerStats()
+	for i := 0; i < maxRecentErrors+2; i++ {
+		call := stats.begin(context.Background(), "user-service", "GetById", uint32(i))
+		stats.end(call, fmt.Errorf("error %d", i))
+	}
+	stats.end(stats.begin(context.Background(), "user-service", "GetById", 0), nil)
+	server := NewServer()
+	server.stats = stats
+
+	snapshot := server.Snapshot()
+	assert.Empty(t, snapshot.Inflight)
+	assert.Len(t, snapshot.RecentErrors, maxRecentErrors)
+	// 从新到旧，最早的两个错误被覆盖
+	assert.Equal(t, fmt.Sprintf("error %d", maxRecentErrors+1), snapshot.RecentErrors[0].Message)
+	assert.Equal(t, "error 2", snapshot.RecentErrors[maxRecentErrors-1].Message)
+	assert.Equal(t, "Unknown", snapshot.RecentErrors[0].Code)
+}
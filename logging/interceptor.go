@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+type config struct {
+	sampleRate float64
+	payloads   bool
+}
+
+type Option func(c *config)
+
+// WithSampleRate 成功调用的采样比例，取值 [0, 1]，失败的调用总会记录
+func WithSampleRate(rate float64) Option {
+	return func(c *config) {
+		c.sampleRate = rate
+	}
+}
+
+// WithPayloads 记录解码后的请求与响应
+// 带有 mrpc:"redact" 标签的字段会被脱敏
+func WithPayloads() Option {
+	return func(c *config) {
+		c.payloads = true
+	}
+}
+
+// ClientInterceptor 客户端访问日志
+func ClientInterceptor(logger *slog.Logger, opts ...Option) mrpc.Interceptor {
+	return interceptor(logger, "mrpc client call", opts)
+}
+
+// ServerInterceptor 服务端访问日志
+func ServerInterceptor(logger *slog.Logger, opts ...Option) mrpc.Interceptor {
+	return interceptor(logger, "mrpc server call", opts)
+}
+
+func interceptor(logger *slog.Logger, msg string, opts []Option) mrpc.Interceptor {
+	cfg := &config{sampleRate: 1}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			code := status.ResultCode(resp, err)
+			if code == status.OK && cfg.sampleRate < 1 && rand.Float64() >= cfg.sampleRate {
+				return resp, err
+			}
+
+			attrs := make([]slog.Attr, 0, 12)
+			peer, _ := mrpc.PeerFromCtx(ctx)
+			attrs = append(attrs,
+				slog.String("service", req.ServiceName),
+				slog.String("method", req.MethodName),
+				slog.Uint64("request_id", uint64(req.RequestID)),
+				slog.String("peer", peer),
+				slog.Duration("duration", time.Since(start)),
+				slog.Int("req_size", len(req.Data)),
+				slog.String("status", code.String()),
+			)
+			level := slog.LevelInfo
+			if resp != nil {
+				attrs = append(attrs, slog.Int("resp_size", len(resp.Data)))
+				if err == nil && len(resp.Error) > 0 {
+					attrs = append(attrs, slog.String("error", string(resp.Error)))
+				}
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			if code != status.OK {
+				level = slog.LevelError
+			}
+			if cfg.payloads {
+				if payload, ok := mrpc.PayloadFromCtx(ctx); ok {
+					attrs = append(attrs,
+						slog.Any("request", Redact(payload.Request())),
+						slog.Any("response", Redact(payload.Response(resp))))
+				}
+			}
+			logger.LogAttrs(ctx, level, msg, attrs...)
+			return resp, err
+		}
+	}
+}
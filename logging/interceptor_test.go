@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type AccountService struct {
+	Login func(ctx context.Context, req *LoginReq) (*LoginResp, error)
+}
+
+func (a AccountService) Name() string {
+	return "account-service"
+}
+
+type LoginReq struct {
+	Name     string
+	Password string `mrpc:"redact"`
+}
+
+type LoginResp struct {
+	Token string `mrpc:"redact"`
+}
+
+type AccountServiceServer struct{}
+
+func (a *AccountServiceServer) Login(ctx context.Context, req *LoginReq) (*LoginResp, error) {
+	if req.Password != "123456" {
+		return nil, errors.New("wrong password")
+	}
+	return &LoginResp{Token: "token"}, nil
+}
+
+func (a *AccountServiceServer) Name() string {
+	return "account-service"
+}
+
+// syncBuffer 服务端与客户端会并发写日志
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) lines(t *testing.T) []map[string]any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var res []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(s.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		res = append(res, entry)
+	}
+	s.buf.Reset()
+	return res
+}
+
+func TestInterceptor(t *testing.T) {
+	serverLog := &syncBuffer{}
+	server := mrpc.NewServer(mrpc.ServerWithInterceptors(
+		ServerInterceptor(slog.New(slog.NewJSONHandler(serverLog, nil)), WithPayloads())))
+	server.RegisterService(&AccountServiceServer{})
+	go func() {
+		err := server.Start("tcp", ":8092")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+	clientLog := &syncBuffer{}
+	client, err := mrpc.NewClient(":8092", mrpc.ClientWithInterceptors(
+		ClientInterceptor(slog.New(slog.NewJSONHandler(clientLog, nil)), WithPayloads())))
+	require.NoError(t, err)
+	service := &AccountService{}
+	require.NoError(t, client.InitService(service))
+
+	testCases := []struct {
+		name string
+		req  *LoginReq
+
+		wantLevel  string
+		wantStatus string
+		wantResp   any
+	}{
+		{
+			name:       "ok",
+			req:        &LoginReq{Name: "Tom", Password: "123456"},
+			wantLevel:  "INFO",
+			wantStatus: "OK",
+			wantResp:   map[string]any{"Token": redacted},
+		},
+		{
+			name:       "error",
+			req:        &LoginReq{Name: "Tom", Password: "654321"},
+			wantLevel:  "ERROR",
+			wantStatus: "Unknown",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _ = service.Login(context.Background(), tc.req)
+			// 服务端写完响应后才记录日志
+			time.Sleep(100 * time.Millisecond)
+			for _, buf := range []*syncBuffer{serverLog, clientLog} {
+				lines := buf.lines(t)
+				require.Len(t, lines, 1)
+				entry := lines[0]
+				assert.Equal(t, tc.wantLevel, entry["level"])
+				assert.Equal(t, "account-service", entry["service"])
+				assert.Equal(t, "Login", entry["method"])
+				assert.Equal(t, tc.wantStatus, entry["status"])
+				assert.NotEmpty(t, entry["peer"])
+				assert.NotZero(t, entry["request_id"])
+				assert.Equal(t, map[string]any{"Name": "Tom", "Password": redacted}, entry["request"])
+				assert.Equal(t, tc.wantResp, entry["response"])
+			}
+		})
+	}
+}
+
+func TestInterceptor_Sampling(t *testing.T) {
+	buf := &syncBuffer{}
+	h := ServerInterceptor(slog.New(slog.NewJSONHandler(buf, nil)), WithSampleRate(0))(
+		func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			if req.MethodName == "Fail" {
+				return nil, errors.New("mock error")
+			}
+			return &message.Response{}, nil
+		})
+	_, _ = h(context.Background(), &message.Request{ServiceName: "user-service", MethodName: "GetById"})
+	assert.Empty(t, buf.lines(t))
+	// 失败的调用不受采样影响
+	_, _ = h(context.Background(), &message.Request{ServiceName: "user-service", MethodName: "Fail"})
+	assert.Len(t, buf.lines(t), 1)
+}
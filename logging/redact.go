@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// Redact 将结构体转换为便于输出的 map
+// 带有 mrpc:"redact" 标签的字段输出为 [REDACTED]，未导出字段会被忽略
+func Redact(val any) any {
+	if val == nil {
+		return nil
+	}
+	return redactValue(reflect.ValueOf(val))
+}
+
+func redactValue(val reflect.Value) any {
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if val.IsNil() {
+			return nil
+		}
+		return redactValue(val.Elem())
+	case reflect.Struct:
+		if t, ok := val.Interface().(time.Time); ok {
+			return t
+		}
+		typ := val.Type()
+		res := make(map[string]any, typ.NumField())
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := fieldName(field)
+			if name == "-" {
+				continue
+			}
+			if hasRedactTag(field) {
+				res[name] = redacted
+				continue
+			}
+			res[name] = redactValue(val.Field(i))
+		}
+		return res
+	case reflect.Slice:
+		if val.IsNil() {
+			return nil
+		}
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return val.Bytes()
+		}
+		fallthrough
+	case reflect.Array:
+		res := make([]any, val.Len())
+		for i := range res {
+			res[i] = redactValue(val.Index(i))
+		}
+		return res
+	case reflect.Map:
+		if val.IsNil() {
+			return nil
+		}
+		res := make(map[string]any, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			res[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value())
+		}
+		return res
+	case reflect.Invalid:
+		return nil
+	}
+	return val.Interface()
+}
+
+// fieldName 优先使用 json 标签中的名字，与 JSON 序列化结果保持一致
+func fieldName(field reflect.StructField) string {
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		name, _, _ := strings.Cut(tag, ",")
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func hasRedactTag(field reflect.StructField) bool {
+	for _, opt := range strings.Split(field.Tag.Get("mrpc"), ",") {
+		if strings.TrimSpace(opt) == "redact" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Account struct {
+	Name     string `json:"name"`
+	Password string `json:"password" mrpc:"redact"`
+	Token    []byte `mrpc:"redact"`
+	Ignored  string `json:"-"`
+	Profile  *Profile
+	Cards    []Card
+	internal string
+}
+
+type Profile struct {
+	Email string `mrpc:"redact"`
+	Age   int
+}
+
+type Card struct {
+	Number string `mrpc:"redact"`
+	Bank   string
+}
+
+func TestRedact(t *testing.T) {
+	testCases := []struct {
+		name    string
+		val     any
+		wantRes any
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "struct",
+			val: &Account{
+				Name:     "Tom",
+				Password: "123456",
+				Token:    []byte("token"),
+				Ignored:  "ignored",
+				Profile:  &Profile{Email: "tom@example.com", Age: 18},
+				Cards:    []Card{{Number: "6222", Bank: "ABC"}},
+				internal: "internal",
+			},
+			wantRes: map[string]any{
+				"name":     "Tom",
+				"password": redacted,
+				"Token":    redacted,
+				"Profile": map[string]any{
+					"Email": redacted,
+					"Age":   18,
+				},
+				"Cards": []any{
+					map[string]any{"Number": redacted, "Bank": "ABC"},
+				},
+			},
+		},
+		{
+			name: "nil field",
+			val:  &Account{Name: "Tom"},
+			wantRes: map[string]any{
+				"name":     "Tom",
+				"password": redacted,
+				"Token":    redacted,
+				"Profile":  nil,
+				"Cards":    nil,
+			},
+		},
+		{
+			name: "map",
+			val:  map[string]*Profile{"tom": {Email: "tom@example.com", Age: 18}},
+			wantRes: map[string]any{
+				"tom": map[string]any{"Email": redacted, "Age": 18},
+			},
+		},
+		{
+			name:    "basic",
+			val:     123,
+			wantRes: 123,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantRes, Redact(tc.val))
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package message
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// FlagChecksum 协议版本字段的最高位，设置后固定头部之后带有 4 字节的 CRC32C 校验和
+// 校验和覆盖除自身之外的整个消息，服务端会为带有该标记的请求返回同样带有校验和的响应
+const FlagChecksum uint8 = 1 << 7
+
+const (
+	checksumLength = 4
+	// reqFixedLength 请求头部固定部分的长度
+	reqFixedLength = 15
+	// respFixedLength 响应头部固定部分的长度，多了一个状态码
+	respFixedLength = 16
+	// legacyRespFixedLength 版本 0 的响应没有状态码
+	legacyRespFixedLength = 15
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func hasChecksum(version uint8) bool {
+	return version&FlagChecksum != 0
+}
+
+// checksumLen 校验和占用的头部长度
+func checksumLen(version uint8) int {
+	if hasChecksum(version) {
+		return checksumLength
+	}
+	return 0
+}
+
+// checksum 计算除了 data[offset:offset+4] 之外部分的 CRC32C
+func checksum(data []byte, offset int) uint32 {
+	c := crc32.Checksum(data[:offset], castagnoli)
+	return crc32.Update(c, castagnoli, data[offset+checksumLength:])
+}
+
+func putChecksum(data []byte, offset int) {
+	if hasChecksum(data[12]) {
+		binary.BigEndian.PutUint32(data[offset:], checksum(data, offset))
+	}
+}
+
+func verify(data []byte, offset int) bool {
+	if len(data) < offset {
+		return false
+	}
+	if !hasChecksum(data[12]) {
+		return true
+	}
+	if len(data) < offset+checksumLength {
+		return false
+	}
+	return binary.BigEndian.Uint32(data[offset:]) == checksum(data, offset)
+}
+
+// VerifyReq 校验编码后的请求，没有设置 FlagChecksum 的请求总是通过
+func VerifyReq(data []byte) bool {
+	return verify(data, reqFixedLength)
+}
+
+// VerifyResp 校验编码后的响应，没有设置 FlagChecksum 的响应总是通过
+func VerifyResp(data []byte) bool {
+	if len(data) < legacyRespFixedLength {
+		return false
+	}
+	return verify(data, respFixedLen(data[12]))
+}
@@ -0,0 +1,125 @@
+package message
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	newReq := func(version uint8) []byte {
+		req := &Request{
+			RequestID:   111,
+			Version:     version,
+			Serializer:  13,
+			ServiceName: "user-service",
+			MethodName:  "GetById",
+			Meta:        map[string]string{"trace-id": "123"},
+			Data:        []byte("hello world"),
+		}
+		req.CalHeaderLen()
+		req.CalBodyLen()
+		data := EncodeReq(req)
+		assert.Equal(t, req, DecodeReq(data))
+		return data
+	}
+	newResp := func(version uint8) []byte {
+		resp := &Response{
+			RequestID:  111,
+			Version:    version,
+			Serializer: 13,
+			Status:     2,
+			Meta:       map[string]string{"trace-id": "123"},
+			Error:      []byte("error message"),
+			Data:       []byte("hello world"),
+		}
+		resp.CalHeaderLength()
+		resp.CalBodyLength()
+		data := EncodeResp(resp)
+		assert.Equal(t, resp, DecodeResp(data))
+		return data
+	}
+	testCases := []struct {
+		name   string
+		data   []byte
+		verify func(data []byte) bool
+		// corrupt 修改消息中的一个字节
+		corrupt int
+
+		want bool
+	}{
+		{
+			name:    "request",
+			data:    newReq(1 | FlagChecksum),
+			verify:  VerifyReq,
+			corrupt: -1,
+			want:    true,
+		},
+		{
+			name:    "request without checksum",
+			data:    newReq(1),
+			verify:  VerifyReq,
+			corrupt: 20,
+			want:    true,
+		},
+		{
+			name:    "request id corrupted",
+			data:    newReq(1 | FlagChecksum),
+			verify:  VerifyReq,
+			corrupt: 8,
+		},
+		{
+			name:    "request checksum corrupted",
+			data:    newReq(1 | FlagChecksum),
+			verify:  VerifyReq,
+			corrupt: 15,
+		},
+		{
+			name:    "request header corrupted",
+			data:    newReq(1 | FlagChecksum),
+			verify:  VerifyReq,
+			corrupt: 20,
+		},
+		{
+			name:    "request data corrupted",
+			data:    newReq(1 | FlagChecksum),
+			verify:  VerifyReq,
+			corrupt: -2,
+		},
+		{
+			name:    "response",
+			data:    newResp(1 | FlagChecksum),
+			verify:  VerifyResp,
+			corrupt: -1,
+			want:    true,
+		},
+		{
+			name:    "response status corrupted",
+			data:    newResp(1 | FlagChecksum),
+			verify:  VerifyResp,
+			corrupt: 15,
+		},
+		{
+			name:    "response data corrupted",
+			data:    newResp(1 | FlagChecksum),
+			verify:  VerifyResp,
+			corrupt: -2,
+		},
+		{
+			name:    "too short",
+			data:    []byte{0, 0, 0, 8},
+			verify:  VerifyReq,
+			corrupt: -1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			switch {
+			case tc.corrupt >= 0:
+				tc.data[tc.corrupt] ^= 0xff
+			case tc.corrupt == -2:
+				tc.data[len(tc.data)-1] ^= 0xff
+			}
+			assert.Equal(t, tc.want, tc.verify(tc.data))
+		})
+	}
+}
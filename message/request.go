@@ -15,7 +15,7 @@ type Request struct {
 	HeadLength uint32 // 消息长度
 	BodyLength uint32 // 协议版本
 	RequestID  uint32 // 消息ID
-	Version    uint8  // 版本
+	Version    uint8  // 版本，最高位为 FlagChecksum
 	Compresser uint8  // 压缩算法
 	Serializer uint8  // 序列化协议
 	// 服务名和方法名
@@ -39,8 +39,8 @@ func EncodeReq(req *Request) []byte {
 	bs[12] = req.Version
 	bs[13] = req.Compresser
 	bs[14] = req.Serializer
-	// 5.写入ServiceName
-	cur := bs[15:]
+	// 5.写入ServiceName，校验和在最后计算
+	cur := bs[reqFixedLength+checksumLen(req.Version):]
 	copy(cur, req.ServiceName)
 	cur = cur[len(req.ServiceName):]
 	cur[0] = nameSeparator
@@ -63,6 +63,7 @@ func EncodeReq(req *Request) []byte {
 	}
 	// 8.data
 	copy(cur, req.Data)
+	putChecksum(bs, reqFixedLength)
 	return bs
 }
 func DecodeReq(data []byte) *Request {
@@ -78,7 +79,7 @@ func DecodeReq(data []byte) *Request {
 	req.Compresser = data[13]
 	req.Serializer = data[14]
 	// 5.ServiceName
-	header := data[15:req.HeadLength]
+	header := data[reqFixedLength+checksumLen(req.Version) : req.HeadLength]
 	index := bytes.IndexByte(header, nameSeparator)
 	req.ServiceName = string(header[:index])
 	header = header[index+1:]
@@ -110,7 +111,7 @@ func DecodeReq(data []byte) *Request {
 	return req
 }
 func (req *Request) CalHeaderLen() {
-	headLength := 15 + len(req.ServiceName) + 1 + len(req.MethodName) + 1
+	headLength := reqFixedLength + checksumLen(req.Version) + len(req.ServiceName) + 1 + len(req.MethodName) + 1
 	for k, v := range req.Meta {
 		headLength += len(k)
 		headLength++
@@ -1,17 +1,23 @@
 package message
 
-import "encoding/binary"
+import (
+	"bytes"
+	"encoding/binary"
+)
 
 type Response struct {
 	// 头部
 	HeadLength uint32 // 消息长度
 	BodyLength uint32 // 协议版本
 	RequestID  uint32 // 消息ID
-	Version    uint8  // 版本
+	Version    uint8  // 版本，最高位为 FlagChecksum，其余为 ProtocolVersion
 	Compresser uint8  // 压缩算法
 	Serializer uint8  // 序列化协议
-	Error      []byte
-	Data       []byte
+	Status     uint8  // 状态码，版本 0 的响应没有
+	// 扩展字段，服务端返回的元数据，版本 0 的响应没有
+	Meta  map[string]string
+	Error []byte
+	Data  []byte
 }
 
 func EncodeResp(resp *Response) []byte {
@@ -26,11 +32,31 @@ func EncodeResp(resp *Response) []byte {
 	bs[12] = resp.Version
 	bs[13] = resp.Compresser
 	bs[14] = resp.Serializer
-
-	cur := bs[15:]
+	fixed := respFixedLen(resp.Version)
+	cur := bs[fixed+checksumLen(resp.Version):]
+	if !legacyResp(resp.Version) {
+		// 5.状态码
+		bs[15] = resp.Status
+		// 6.meta，以单独的分隔符结尾
+		for k, v := range resp.Meta {
+			copy(cur, k)
+			cur = cur[len(k):]
+			cur[0] = metaSeparator
+			cur = cur[1:]
+			copy(cur, v)
+			cur = cur[len(v):]
+			cur[0] = nameSeparator
+			cur = cur[1:]
+		}
+		cur[0] = nameSeparator
+		cur = cur[1:]
+	}
+	// 7.error
 	copy(cur, resp.Error)
 	cur = cur[len(resp.Error):]
+	// 8.data
 	copy(cur, resp.Data)
+	putChecksum(bs, fixed)
 
 	return bs
 }
@@ -47,9 +73,31 @@ func DecodeResp(data []byte) *Response {
 	resp.Version = data[12]
 	resp.Compresser = data[13]
 	resp.Serializer = data[14]
-	if resp.HeadLength > 15 {
-		resp.Error = data[15:resp.HeadLength]
+	header := data[respFixedLen(resp.Version)+checksumLen(resp.Version) : resp.HeadLength]
+	if !legacyResp(resp.Version) {
+		// 5.状态码
+		resp.Status = data[15]
+		// 6.meta
+		index := bytes.IndexByte(header, nameSeparator)
+		if index > 0 {
+			meta := make(map[string]string, 4)
+			for index > 0 {
+				pair := header[:index]
+				pairIndex := bytes.IndexByte(pair, metaSeparator)
+				meta[string(pair[:pairIndex])] = string(pair[pairIndex+1:])
+
+				header = header[index+1:]
+				index = bytes.IndexByte(header, nameSeparator)
+			}
+			resp.Meta = meta
+		}
+		header = header[1:]
 	}
+	// 7.error
+	if len(header) > 0 {
+		resp.Error = header
+	}
+	// 8.data
 	if resp.BodyLength != 0 {
 		resp.Data = data[resp.HeadLength:]
 	}
@@ -57,7 +105,20 @@ func DecodeResp(data []byte) *Response {
 }
 
 func (resp *Response) CalHeaderLength() {
-	resp.HeadLength = 15 + uint32(len(resp.Error))
+	headLength := respFixedLen(resp.Version) + checksumLen(resp.Version) + len(resp.Error)
+	if legacyResp(resp.Version) {
+		resp.HeadLength = uint32(headLength)
+		return
+	}
+	// 元数据结尾的分隔符
+	headLength++
+	for k, v := range resp.Meta {
+		headLength += len(k)
+		headLength++
+		headLength += len(v)
+		headLength++
+	}
+	resp.HeadLength = uint32(headLength)
 }
 
 func (resp *Response) CalBodyLength() {
@@ -17,8 +17,13 @@ func TestRespEncodeDecode(t *testing.T) {
 				Version:    11,
 				Compresser: 12,
 				Serializer: 13,
-				Error:      []byte("error message"),
-				Data:       []byte("hello, world"),
+				Status:     2,
+				Meta: map[string]string{
+					"request-id": "123",
+					"tenant":     "a",
+				},
+				Error: []byte("error message"),
+				Data:  []byte("hello, world"),
 			},
 		},
 		{
@@ -31,6 +36,19 @@ func TestRespEncodeDecode(t *testing.T) {
 				Error:      []byte("error message"),
 			},
 		},
+		{
+			name: "error with separator",
+			resp: &Response{
+				RequestID:  111,
+				Version:    11,
+				Compresser: 12,
+				Serializer: 13,
+				Meta: map[string]string{
+					"tenant": "a",
+				},
+				Error: []byte("error \n message"),
+			},
+		},
 		{
 			name: "no error",
 			resp: &Response{
@@ -52,3 +70,32 @@ func TestRespEncodeDecode(t *testing.T) {
 		})
 	}
 }
+
+// TestRespEncodeDecode_Legacy 版本 0 的响应没有状态码和元数据，与最初的格式一致
+func TestRespEncodeDecode_Legacy(t *testing.T) {
+	resp := &Response{
+		RequestID:  111,
+		Compresser: 12,
+		Serializer: 13,
+		Status:     2,
+		Meta:       map[string]string{"tenant": "a"},
+		Error:      []byte("error message"),
+		Data:       []byte("hello, world"),
+	}
+	resp.CalHeaderLength()
+	resp.CalBodyLength()
+	data := EncodeResp(resp)
+	assert.Equal(t, uint32(15+len("error message")), resp.HeadLength)
+	assert.Equal(t, []byte("error message"), data[15:resp.HeadLength])
+	assert.True(t, ValidResp(data))
+	assert.True(t, VerifyResp(data))
+	assert.Equal(t, &Response{
+		HeadLength: resp.HeadLength,
+		BodyLength: resp.BodyLength,
+		RequestID:  111,
+		Compresser: 12,
+		Serializer: 13,
+		Error:      []byte("error message"),
+		Data:       []byte("hello, world"),
+	}, DecodeResp(data))
+}
@@ -0,0 +1,77 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// frameHeader 检查长度字段并返回头部的变长部分，fixed 为头部固定部分的长度
+func frameHeader(data []byte, fixed int) ([]byte, bool) {
+	if len(data) < fixed {
+		return nil, false
+	}
+	headLength := uint64(binary.BigEndian.Uint32(data[:4]))
+	bodyLength := uint64(binary.BigEndian.Uint32(data[4:8]))
+	fixed += checksumLen(data[12])
+	if headLength < uint64(fixed) || headLength+bodyLength != uint64(len(data)) {
+		return nil, false
+	}
+	return data[fixed:headLength], true
+}
+
+// validPair 元数据必须是 key\rvalue 的形式
+func validPair(pair []byte) bool {
+	return bytes.IndexByte(pair, metaSeparator) != -1
+}
+
+// ValidReq 检查请求帧的长度字段和头部分隔符，通过检查的帧才能交给 DecodeReq
+func ValidReq(data []byte) bool {
+	header, ok := frameHeader(data, reqFixedLength)
+	if !ok {
+		return false
+	}
+	// 服务名和方法名
+	for i := 0; i < 2; i++ {
+		index := bytes.IndexByte(header, nameSeparator)
+		if index == -1 {
+			return false
+		}
+		header = header[index+1:]
+	}
+	for index := bytes.IndexByte(header, nameSeparator); index != -1; index = bytes.IndexByte(header, nameSeparator) {
+		if !validPair(header[:index]) {
+			return false
+		}
+		header = header[index+1:]
+	}
+	return true
+}
+
+// ValidResp 检查响应帧的长度字段和头部分隔符，通过检查的帧才能交给 DecodeResp
+func ValidResp(data []byte) bool {
+	if len(data) < legacyRespFixedLength {
+		return false
+	}
+	header, ok := frameHeader(data, respFixedLen(data[12]))
+	if !ok {
+		return false
+	}
+	if legacyResp(data[12]) {
+		// 版本 0 的头部只有错误信息
+		return true
+	}
+	// 元数据以单独的分隔符结尾
+	for {
+		index := bytes.IndexByte(header, nameSeparator)
+		switch {
+		case index == 0:
+			return true
+		case index == -1:
+			return false
+		}
+		if !validPair(header[:index]) {
+			return false
+		}
+		header = header[index+1:]
+	}
+}
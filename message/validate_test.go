@@ -0,0 +1,85 @@
+package message
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidReq(t *testing.T) {
+	req := &Request{
+		RequestID:   1,
+		Version:     FlagChecksum,
+		ServiceName: "user-service",
+		MethodName:  "GetById",
+		Meta:        map[string]string{"trace-id": "123"},
+		Data:        []byte("hello"),
+	}
+	req.CalHeaderLen()
+	req.CalBodyLen()
+	valid := EncodeReq(req)
+	frame := func(header string, body string) []byte {
+		data := make([]byte, 15, 15+len(header)+len(body))
+		data[3] = byte(15 + len(header))
+		data[7] = byte(len(body))
+		return append(append(data, header...), body...)
+	}
+	testCases := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "valid", data: valid, want: true},
+		{name: "no meta", data: frame("user-service\nGetById\n", "{}"), want: true},
+		{name: "too short", data: []byte{0, 0, 0, 8, 0, 0, 0, 0}},
+		{name: "head length below fixed", data: append([]byte{0, 0, 0, 8, 0, 0, 0, 7}, make([]byte, 7)...)},
+		{name: "length mismatch", data: valid[:len(valid)-1]},
+		{name: "no separator", data: frame("", "")},
+		{name: "no method separator", data: frame("user-service\nGetById", "")},
+		{name: "meta without separator", data: frame("user-service\nGetById\ntrace-id\n", "")},
+		{name: "checksum longer than header", data: append([]byte{0, 0, 0, 17, 0, 0, 0, 0, 0, 0, 0, 0, FlagChecksum}, make([]byte, 4)...)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ValidReq(tc.data))
+		})
+	}
+}
+
+func TestValidResp(t *testing.T) {
+	resp := &Response{
+		RequestID: 1,
+		Version:   ProtocolVersion,
+		Status:    2,
+		Meta:      map[string]string{"trace-id": "123"},
+		Error:     []byte("error\nmessage"),
+		Data:      []byte("hello"),
+	}
+	resp.CalHeaderLength()
+	resp.CalBodyLength()
+	valid := EncodeResp(resp)
+	frame := func(header string) []byte {
+		data := make([]byte, 16, 16+len(header))
+		data[3] = byte(16 + len(header))
+		data[12] = ProtocolVersion
+		return append(data, header...)
+	}
+	testCases := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "valid", data: valid, want: true},
+		{name: "no meta", data: frame("\nerror"), want: true},
+		{name: "too short", data: make([]byte, 15)},
+		{name: "too short for version", data: []byte{0, 0, 0, 15, 0, 0, 0, 0, 0, 0, 0, 0, ProtocolVersion, 0, 0}},
+		{name: "legacy", data: []byte{0, 0, 0, 17, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, '\n', 'e'}, want: true},
+		{name: "no terminator", data: frame("")},
+		{name: "meta without terminator", data: frame("trace-id\r123\n")},
+		{name: "meta without separator", data: frame("trace-id\n\n")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ValidResp(tc.data))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package message
+
+// ProtocolVersion 当前的协议版本，占用版本字段除 FlagChecksum 之外的低 7 位
+//
+// 版本 0 为最初的格式，响应的固定头部为 15 字节，之后直接是错误信息，没有状态码和元数据
+// 版本 1 的响应固定头部为 16 字节，多了一个状态码，之后是以单独的分隔符结尾的元数据
+// 请求的格式在两个版本中相同，服务端按照请求的版本编码响应，因此旧的客户端仍然可以调用新的服务端
+// 旧的服务端不认识版本 1，新的客户端不能调用旧的服务端
+const ProtocolVersion uint8 = 1
+
+// protocolVersion 去掉标记位之后的协议版本
+func protocolVersion(version uint8) uint8 {
+	return version &^ FlagChecksum
+}
+
+// legacyResp 是否使用版本 0 的响应格式
+func legacyResp(version uint8) bool {
+	return protocolVersion(version) == 0
+}
+
+// respFixedLen 响应头部固定部分的长度
+func respFixedLen(version uint8) int {
+	if legacyResp(version) {
+		return legacyRespFixedLength
+	}
+	return respFixedLength
+}
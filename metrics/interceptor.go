@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"time"
+)
+
+// ClientInterceptor 统计客户端调用
+func (m *Metrics) ClientInterceptor() mrpc.Interceptor {
+	return m.interceptor(m.clientRequests, m.clientLatency, m.clientInFlight, m.clientReqSize, m.clientRespSize)
+}
+
+// ServerInterceptor 统计服务端调用
+func (m *Metrics) ServerInterceptor() mrpc.Interceptor {
+	return m.interceptor(m.serverRequests, m.serverLatency, m.serverInFlight, m.serverReqSize, m.serverRespSize)
+}
+
+func (m *Metrics) interceptor(requests, latency, inFlight, reqSize, respSize *family) mrpc.Interceptor {
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			service, method := req.ServiceName, req.MethodName
+			inFlight.add(1, service, method)
+			reqSize.observe(float64(len(req.Data)), service, method)
+			start := time.Now()
+
+			resp, err := next(ctx, req)
+
+			code := status.ResultCode(resp, err).String()
+			inFlight.add(-1, service, method)
+			requests.add(1, service, method, code)
+			latency.observe(time.Since(start).Seconds(), service, method, code)
+			if resp != nil {
+				respSize.observe(float64(len(resp.Data)), service, method)
+			}
+			return resp, err
+		}
+	}
+}
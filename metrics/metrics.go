@@ -0,0 +1,284 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/NotFound1911/mrpc/pool"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefLatencyBuckets 耗时分布，单位秒
+	DefLatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefSizeBuckets 数据大小分布，单位字节
+	DefSizeBuckets = []float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+)
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// series 某一组 label 取值对应的数据
+type series struct {
+	labelValues []string
+	value       float64
+	// 以下字段仅 histogram 使用
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// family 同名指标
+type family struct {
+	name       string
+	help       string
+	typ        metricType
+	labelNames []string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+func newFamily(name, help string, typ metricType, buckets []float64, labelNames ...string) *family {
+	return &family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series, 16),
+	}
+}
+
+// get 调用方需要持有锁
+func (f *family) get(labelValues []string) *series {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues}
+		if f.typ == typeHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) add(delta float64, labelValues ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.get(labelValues).value += delta
+}
+
+func (f *family) set(val float64, labelValues ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.get(labelValues).value = val
+}
+
+func (f *family) observe(val float64, labelValues ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s := f.get(labelValues)
+	for i, upper := range f.buckets {
+		if val <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += val
+	s.count++
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.series) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		labels := f.labels(s.labelValues)
+		if f.typ != typeHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+			continue
+		}
+		for i, upper := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name,
+				wrapLabels(append(labels, `le="`+formatFloat(upper)+`"`)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, wrapLabels(append(labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, wrapLabels(labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, wrapLabels(labels), s.count)
+	}
+}
+
+func (f *family) labels(values []string) []string {
+	res := make([]string, 0, len(values)+1)
+	for i, name := range f.labelNames {
+		res = append(res, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	return res
+}
+
+func wrapLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(val string) string {
+	return labelEscaper.Replace(val)
+}
+
+func formatFloat(val float64) string {
+	switch {
+	case math.IsInf(val, 1):
+		return "+Inf"
+	case math.IsInf(val, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+// PoolStatser 可以统计连接池状态的对象，例如 *mrpc.Client
+type PoolStatser interface {
+	PoolStats() pool.Stats
+}
+
+// Metrics 指标注册中心，汇总客户端与服务端的调用指标
+type Metrics struct {
+	clientRequests *family
+	clientLatency  *family
+	clientInFlight *family
+	clientReqSize  *family
+	clientRespSize *family
+
+	serverRequests *family
+	serverLatency  *family
+	serverInFlight *family
+	serverReqSize  *family
+	serverRespSize *family
+
+	poolConns  *family
+	poolEvents *family
+
+	mutex sync.Mutex
+	pools map[string]PoolStatser
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		clientRequests: newFamily("mrpc_client_requests_total", "Total number of RPCs completed by the client.",
+			typeCounter, nil, "service", "method", "status"),
+		clientLatency: newFamily("mrpc_client_request_duration_seconds", "Latency of RPCs completed by the client.",
+			typeHistogram, DefLatencyBuckets, "service", "method", "status"),
+		clientInFlight: newFamily("mrpc_client_in_flight_requests", "Number of RPCs currently in flight on the client.",
+			typeGauge, nil, "service", "method"),
+		clientReqSize: newFamily("mrpc_client_request_size_bytes", "Size of request payloads sent by the client.",
+			typeHistogram, DefSizeBuckets, "service", "method"),
+		clientRespSize: newFamily("mrpc_client_response_size_bytes", "Size of response payloads received by the client.",
+			typeHistogram, DefSizeBuckets, "service", "method"),
+
+		serverRequests: newFamily("mrpc_server_requests_total", "Total number of RPCs completed by the server.",
+			typeCounter, nil, "service", "method", "status"),
+		serverLatency: newFamily("mrpc_server_request_duration_seconds", "Latency of RPCs handled by the server.",
+			typeHistogram, DefLatencyBuckets, "service", "method", "status"),
+		serverInFlight: newFamily("mrpc_server_in_flight_requests", "Number of RPCs currently handled by the server.",
+			typeGauge, nil, "service", "method"),
+		serverReqSize: newFamily("mrpc_server_request_size_bytes", "Size of request payloads received by the server.",
+			typeHistogram, DefSizeBuckets, "service", "method"),
+		serverRespSize: newFamily("mrpc_server_response_size_bytes", "Size of response payloads sent by the server.",
+			typeHistogram, DefSizeBuckets, "service", "method"),
+
+		poolConns: newFamily("mrpc_client_pool_connections", "Number of pooled client connections by state.",
+			typeGauge, nil, "pool", "state"),
+		poolEvents: newFamily("mrpc_client_pool_events_total", "Total number of client connection pool events by type.",
+			typeCounter, nil, "pool", "event"),
+		pools: make(map[string]PoolStatser, 4),
+	}
+}
+
+// RegisterPool 注册连接池，在输出指标时采集其状态
+func (m *Metrics) RegisterPool(name string, p PoolStatser) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pools[name] = p
+}
+
+func (m *Metrics) collectPools() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for name, p := range m.pools {
+		stats := p.PoolStats()
+		m.poolConns.set(float64(stats.Idle), name, "idle")
+		m.poolConns.set(float64(stats.Active), name, "active")
+		m.poolEvents.set(float64(stats.Dials), name, "dial")
+		m.poolEvents.set(float64(stats.DialErrors), name, "dial_error")
+		m.poolEvents.set(float64(stats.Broken), name, "broken")
+		m.poolEvents.set(float64(stats.Expired), name, "expired")
+		m.poolEvents.set(float64(stats.Waits), name, "wait")
+	}
+}
+
+// WriteTo 以 Prometheus 文本格式输出所有指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.collectPools()
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range []*family{
+		m.clientRequests, m.clientLatency, m.clientInFlight, m.clientReqSize, m.clientRespSize,
+		m.serverRequests, m.serverLatency, m.serverInFlight, m.serverReqSize, m.serverRespSize,
+		m.poolConns, m.poolEvents,
+	} {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Handler 用于暴露给 Prometheus 抓取
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = m.WriteTo(w)
+	})
+}
+
+// ListenAndServe 在 addr 上启动 HTTP 服务，通过 /metrics 暴露指标
+func (m *Metrics) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/pool"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakePool pool.Stats
+
+func (f fakePool) PoolStats() pool.Stats {
+	return pool.Stats(f)
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.RegisterPool("user-service", fakePool{Idle: 3, Active: 2, Dials: 6, Broken: 1})
+	testCases := []struct {
+		name string
+		resp *message.Response
+		err  error
+	}{
+		{
+			name: "ok",
+			resp: &message.Response{Data: []byte("hello")},
+		},
+		{
+			name: "business error",
+			resp: &message.Response{Status: uint8(status.NotFound), Error: []byte("not found")},
+		},
+		{
+			name: "error",
+			err:  errors.New("connection reset"),
+		},
+	}
+	client := m.ClientInterceptor()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := client(func(ctx context.Context, req *message.Request) (*message.Response, error) {
+				return tc.resp, tc.err
+			})
+			_, _ = h(context.Background(), &message.Request{
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Data:        []byte(`{"Id":123}`),
+			})
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	_, err := m.WriteTo(buf)
+	require.NoError(t, err)
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE mrpc_client_requests_total counter\n",
+		`mrpc_client_requests_total{service="user-service",method="GetById",status="OK"} 1` + "\n",
+		`mrpc_client_requests_total{service="user-service",method="GetById",status="NotFound"} 1` + "\n",
+		`mrpc_client_requests_total{service="user-service",method="GetById",status="Unknown"} 1` + "\n",
+		"# TYPE mrpc_client_request_duration_seconds histogram\n",
+		`mrpc_client_request_duration_seconds_bucket{service="user-service",method="GetById",status="OK",le="+Inf"} 1` + "\n",
+		`mrpc_client_in_flight_requests{service="user-service",method="GetById"} 0` + "\n",
+		`mrpc_client_request_size_bytes_bucket{service="user-service",method="GetById",le="64"} 3` + "\n",
+		`mrpc_client_request_size_bytes_sum{service="user-service",method="GetById"} 30` + "\n",
+		`mrpc_client_response_size_bytes_count{service="user-service",method="GetById"} 2` + "\n",
+		`mrpc_client_pool_connections{pool="user-service",state="active"} 2` + "\n",
+		`mrpc_client_pool_connections{pool="user-service",state="idle"} 3` + "\n",
+		"# TYPE mrpc_client_pool_events_total counter\n",
+		`mrpc_client_pool_events_total{pool="user-service",event="dial"} 6` + "\n",
+		`mrpc_client_pool_events_total{pool="user-service",event="broken"} 1` + "\n",
+	} {
+		assert.Contains(t, out, line)
+	}
+	// 服务端没有调用，不输出
+	assert.NotContains(t, out, "mrpc_server_requests_total")
+}
+
+func TestMetrics_InFlight(t *testing.T) {
+	m := NewMetrics()
+	h := m.ServerInterceptor()(func(ctx context.Context, req *message.Request) (*message.Response, error) {
+		buf := &bytes.Buffer{}
+		_, _ = m.WriteTo(buf)
+		assert.Contains(t, buf.String(), `mrpc_server_in_flight_requests{service="user-service",method="GetById"} 1`)
+		return &message.Response{}, nil
+	})
+	_, err := h(context.Background(), &message.Request{ServiceName: "user-service", MethodName: "GetById"})
+	assert.NoError(t, err)
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := NewMetrics()
+	m.serverRequests.add(1, "a\"b", "Get\\", "OK")
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP mrpc_server_requests_total Total number of RPCs completed by the server.
+# TYPE mrpc_server_requests_total counter
+mrpc_server_requests_total{service="a\"b",method="Get\\",status="OK"} 1
+`, recorder.Body.String())
+}
@@ -0,0 +1,294 @@
+// Package pool 客户端连接池，每个地址一个连接池
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed 连接池已经关闭
+var ErrClosed = errors.New("pool: 连接池已关闭")
+
+type Config struct {
+	// InitialCap 创建连接池后在后台预先建立的连接数，建立失败不影响连接池的使用
+	InitialCap int
+	// MaxIdle 最大空闲连接数，为 0 时使用默认值 10
+	MaxIdle int
+	// MaxActive 最大连接数，包含空闲连接，为 0 时不限制
+	// 连接数达到上限时 Get 等待其他连接归还
+	MaxActive int
+	// IdleTimeout 空闲超过该时间的连接会被关闭，为 0 时不限制
+	IdleTimeout time.Duration
+	// MaxLifetime 连接的最长使用时间，为 0 时不限制
+	MaxLifetime time.Duration
+	// DialTimeout 建立连接的超时时间，为 0 时使用默认值 3s
+	DialTimeout time.Duration
+	// Dial 建立连接，为空时使用 TCP
+	Dial func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// DefaultConfig 客户端默认使用的配置
+func DefaultConfig() Config {
+	return Config{
+		InitialCap:  5,
+		MaxIdle:     10,
+		MaxActive:   30,
+		IdleTimeout: time.Minute,
+		DialTimeout: 3 * time.Second,
+	}
+}
+
+// Stats 连接池的统计信息
+type Stats struct {
+	Addr string
+	// Idle 空闲连接数
+	Idle int
+	// Active 正在使用的连接数
+	Active int
+	// Dials 建立连接的次数，DialErrors 建立连接失败的次数
+	Dials      int64
+	DialErrors int64
+	// Broken 因为 I/O 错误被丢弃的连接数
+	Broken int64
+	// Expired 因为空闲超时或者超过最长使用时间被关闭的连接数
+	Expired int64
+	// Waits 因为连接数达到上限而等待的次数
+	Waits int64
+}
+
+// Conn 连接池中的连接
+type Conn struct {
+	net.Conn
+	createdAt  time.Time
+	returnedAt time.Time
+}
+
+type Pool struct {
+	addr string
+	cfg  Config
+
+	mutex  sync.Mutex
+	idle   []*Conn
+	active int
+	total  int
+	closed bool
+	// released 有连接归还或者关闭时关闭并替换，用于唤醒等待的 Get
+	released chan struct{}
+
+	dials      atomic.Int64
+	dialErrors atomic.Int64
+	broken     atomic.Int64
+	expired    atomic.Int64
+	waits      atomic.Int64
+}
+
+// New 创建连接池，不会立刻建立连接
+func New(addr string, cfg Config) *Pool {
+	if cfg.MaxIdle <= 0 {
+		cfg.MaxIdle = 10
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 3 * time.Second
+	}
+	if cfg.Dial == nil {
+		dialer := &net.Dialer{}
+		cfg.Dial = func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+	}
+	res := &Pool{
+		addr:     addr,
+		cfg:      cfg,
+		idle:     make([]*Conn, 0, cfg.MaxIdle),
+		released: make(chan struct{}),
+	}
+	if cfg.InitialCap > 0 {
+		go res.warmup(cfg.InitialCap)
+	}
+	return res
+}
+
+// warmup 在后台建立连接，失败时放弃
+func (p *Pool) warmup(n int) {
+	for i := 0; i < n; i++ {
+		p.mutex.Lock()
+		if p.closed || len(p.idle) >= p.cfg.MaxIdle || p.full() {
+			p.mutex.Unlock()
+			return
+		}
+		p.total++
+		p.mutex.Unlock()
+
+		conn, err := p.dial(context.Background())
+		p.mutex.Lock()
+		if err != nil {
+			p.total--
+			p.notify()
+			p.mutex.Unlock()
+			return
+		}
+		if p.closed {
+			p.total--
+			p.mutex.Unlock()
+			_ = conn.Close()
+			return
+		}
+		conn.returnedAt = time.Now()
+		p.idle = append(p.idle, conn)
+		p.notify()
+		p.mutex.Unlock()
+	}
+}
+
+// full 连接数是否达到上限，调用方需要持有锁
+func (p *Pool) full() bool {
+	return p.cfg.MaxActive > 0 && p.total >= p.cfg.MaxActive
+}
+
+// notify 唤醒等待的 Get，调用方需要持有锁
+func (p *Pool) notify() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+func (p *Pool) expiredAt(conn *Conn, now time.Time) bool {
+	if p.cfg.MaxLifetime > 0 && now.Sub(conn.createdAt) >= p.cfg.MaxLifetime {
+		return true
+	}
+	return p.cfg.IdleTimeout > 0 && now.Sub(conn.returnedAt) >= p.cfg.IdleTimeout
+}
+
+func (p *Pool) dial(ctx context.Context) (*Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.DialTimeout)
+	defer cancel()
+	p.dials.Add(1)
+	conn, err := p.cfg.Dial(ctx, p.addr)
+	if err != nil {
+		p.dialErrors.Add(1)
+		return nil, err
+	}
+	return &Conn{Conn: conn, createdAt: time.Now()}, nil
+}
+
+// Get 获取连接，优先使用最近归还的空闲连接，没有时建立新的连接
+// 使用完毕后必须调用 Put 归还
+func (p *Pool) Get(ctx context.Context) (*Conn, error) {
+	for {
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			return nil, ErrClosed
+		}
+		now := time.Now()
+		for len(p.idle) > 0 {
+			conn := p.idle[len(p.idle)-1]
+			p.idle = p.idle[:len(p.idle)-1]
+			if p.expiredAt(conn, now) {
+				p.total--
+				p.expired.Add(1)
+				_ = conn.Close()
+				continue
+			}
+			p.active++
+			p.mutex.Unlock()
+			return conn, nil
+		}
+		if !p.full() {
+			p.total++
+			p.active++
+			p.mutex.Unlock()
+			conn, err := p.dial(ctx)
+			if err != nil {
+				p.mutex.Lock()
+				p.total--
+				p.active--
+				p.notify()
+				p.mutex.Unlock()
+				return nil, err
+			}
+			return conn, nil
+		}
+		released := p.released
+		p.mutex.Unlock()
+		p.waits.Add(1)
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Put 归还连接
+// err 为使用连接过程中发生的 I/O 错误，不为 nil 时连接会被关闭而不是放回连接池
+func (p *Pool) Put(conn *Conn, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.active--
+	defer p.notify()
+	now := time.Now()
+	switch {
+	case err != nil:
+		p.broken.Add(1)
+	case p.closed || len(p.idle) >= p.cfg.MaxIdle:
+	case p.cfg.MaxLifetime > 0 && now.Sub(conn.createdAt) >= p.cfg.MaxLifetime:
+		p.expired.Add(1)
+	default:
+		conn.returnedAt = now
+		p.idle = append(p.idle, conn)
+		return
+	}
+	p.total--
+	_ = conn.Close()
+}
+
+// Stats 返回连接池的统计信息
+func (p *Pool) Stats() Stats {
+	p.mutex.Lock()
+	idle, active := len(p.idle), p.active
+	p.mutex.Unlock()
+	return Stats{
+		Addr:       p.addr,
+		Idle:       idle,
+		Active:     active,
+		Dials:      p.dials.Load(),
+		DialErrors: p.dialErrors.Load(),
+		Broken:     p.broken.Load(),
+		Expired:    p.expired.Load(),
+		Waits:      p.waits.Load(),
+	}
+}
+
+// CloseIdle 关闭所有空闲连接，正在使用的连接不受影响
+// 已知对端即将关闭时调用，避免之后的调用拿到失效的连接
+func (p *Pool) CloseIdle() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, conn := range p.idle {
+		_ = conn.Close()
+	}
+	p.total -= len(p.idle)
+	p.idle = nil
+	p.notify()
+}
+
+// Close 关闭所有空闲连接，正在使用的连接在归还时关闭
+func (p *Pool) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	for _, conn := range p.idle {
+		_ = conn.Close()
+	}
+	p.total -= len(p.idle)
+	p.idle = nil
+	p.notify()
+	return nil
+}
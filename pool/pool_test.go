@@ -0,0 +1,176 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeDial 使用 net.Pipe 模拟建立连接
+func pipeDial(ctx context.Context, addr string) (net.Conn, error) {
+	client, _ := net.Pipe()
+	return client, nil
+}
+
+func TestPool(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  Config
+		run  func(t *testing.T, p *Pool)
+
+		wantStats Stats
+	}{
+		{
+			name: "reuse",
+			cfg:  Config{Dial: pipeDial},
+			run: func(t *testing.T, p *Pool) {
+				conn, err := p.Get(context.Background())
+				require.NoError(t, err)
+				p.Put(conn, nil)
+				again, err := p.Get(context.Background())
+				require.NoError(t, err)
+				assert.Same(t, conn, again)
+				p.Put(again, nil)
+			},
+			wantStats: Stats{Idle: 1, Dials: 1},
+		},
+		{
+			name: "broken",
+			cfg:  Config{Dial: pipeDial},
+			run: func(t *testing.T, p *Pool) {
+				conn, err := p.Get(context.Background())
+				require.NoError(t, err)
+				p.Put(conn, errors.New("broken pipe"))
+				_, err = conn.Write([]byte("a"))
+				assert.ErrorIs(t, err, io.ErrClosedPipe)
+			},
+			wantStats: Stats{Dials: 1, Broken: 1},
+		},
+		{
+			name: "dial error",
+			cfg: Config{Dial: func(ctx context.Context, addr string) (net.Conn, error) {
+				return nil, errors.New("connection refused")
+			}},
+			run: func(t *testing.T, p *Pool) {
+				_, err := p.Get(context.Background())
+				assert.EqualError(t, err, "connection refused")
+			},
+			wantStats: Stats{Dials: 1, DialErrors: 1},
+		},
+		{
+			name: "max idle",
+			cfg:  Config{Dial: pipeDial, MaxIdle: 1},
+			run: func(t *testing.T, p *Pool) {
+				c1, err := p.Get(context.Background())
+				require.NoError(t, err)
+				c2, err := p.Get(context.Background())
+				require.NoError(t, err)
+				p.Put(c1, nil)
+				p.Put(c2, nil)
+			},
+			wantStats: Stats{Idle: 1, Dials: 2},
+		},
+		{
+			name: "max lifetime",
+			cfg:  Config{Dial: pipeDial, MaxLifetime: 10 * time.Millisecond},
+			run: func(t *testing.T, p *Pool) {
+				conn, err := p.Get(context.Background())
+				require.NoError(t, err)
+				time.Sleep(20 * time.Millisecond)
+				p.Put(conn, nil)
+			},
+			wantStats: Stats{Dials: 1, Expired: 1},
+		},
+		{
+			name: "idle timeout",
+			cfg:  Config{Dial: pipeDial, IdleTimeout: 10 * time.Millisecond},
+			run: func(t *testing.T, p *Pool) {
+				conn, err := p.Get(context.Background())
+				require.NoError(t, err)
+				p.Put(conn, nil)
+				time.Sleep(20 * time.Millisecond)
+				again, err := p.Get(context.Background())
+				require.NoError(t, err)
+				assert.NotSame(t, conn, again)
+			},
+			wantStats: Stats{Active: 1, Dials: 2, Expired: 1},
+		},
+		{
+			name: "max active",
+			cfg:  Config{Dial: pipeDial, MaxActive: 1},
+			run: func(t *testing.T, p *Pool) {
+				conn, err := p.Get(context.Background())
+				require.NoError(t, err)
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				_, err = p.Get(ctx)
+				assert.Equal(t, context.DeadlineExceeded, err)
+
+				// 连接归还后等待的 Get 拿到该连接
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					p.Put(conn, nil)
+				}()
+				again, err := p.Get(context.Background())
+				require.NoError(t, err)
+				assert.Same(t, conn, again)
+			},
+			wantStats: Stats{Active: 1, Dials: 1, Waits: 2},
+		},
+		{
+			name: "closed",
+			cfg:  Config{Dial: pipeDial},
+			run: func(t *testing.T, p *Pool) {
+				conn, err := p.Get(context.Background())
+				require.NoError(t, err)
+				require.NoError(t, p.Close())
+				p.Put(conn, nil)
+				_, err = p.Get(context.Background())
+				assert.Equal(t, ErrClosed, err)
+			},
+			wantStats: Stats{Dials: 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := New("user-service", tc.cfg)
+			tc.run(t, p)
+			tc.wantStats.Addr = "user-service"
+			assert.Equal(t, tc.wantStats, p.Stats())
+		})
+	}
+}
+
+func TestPool_Warmup(t *testing.T) {
+	p := New("user-service", Config{Dial: pipeDial, InitialCap: 3, MaxIdle: 2})
+	assert.Eventually(t, func() bool {
+		return p.Stats().Idle == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(2), p.Stats().Dials)
+}
+
+func TestPool_CloseIdle(t *testing.T) {
+	p := New("user-service", Config{Dial: pipeDial, MaxIdle: 2})
+	ctx := context.Background()
+	c1, err := p.Get(ctx)
+	require.NoError(t, err)
+	c2, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(c1, nil)
+	p.CloseIdle()
+	stats := p.Stats()
+	assert.Equal(t, 0, stats.Idle)
+	assert.Equal(t, 1, stats.Active)
+
+	// 正在使用的连接仍然可以放回
+	p.Put(c2, nil)
+	assert.Equal(t, 1, p.Stats().Idle)
+	c3, err := p.Get(ctx)
+	require.NoError(t, err)
+	assert.Same(t, c2, c3)
+}
@@ -0,0 +1,140 @@
+package mrpc
+
+import (
+	"context"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"reflect"
+	"sort"
+)
+
+// ReflectionServiceName 反射服务的服务名
+const ReflectionServiceName = "mrpc.reflection"
+
+// ServerWithReflection 注册反射服务，客户端可以通过它查询服务端注册的服务和方法
+func ServerWithReflection() ServerOption {
+	return func(server *Server) {
+		server.RegisterService(&reflectionService{server: server})
+	}
+}
+
+type ListServicesReq struct {
+}
+
+type ListServicesResp struct {
+	Services []ServiceInfo
+	// FileDescriptors 方法中用到的 proto 消息所在的文件及其依赖
+	// 每一项都是序列化后的 descriptorpb.FileDescriptorProto，依赖排在前面
+	FileDescriptors [][]byte
+}
+
+type ServiceInfo struct {
+	Name    string
+	Methods []MethodInfo
+}
+
+type MethodInfo struct {
+	Name string
+	// Request 和 Response 为 Go 类型名，例如 *mrpc.GetByIdReq
+	Request  string
+	Response string
+	// RequestProto 和 ResponseProto 为 proto 消息的全名，不是 proto 消息时为空
+	RequestProto  string
+	ResponseProto string
+}
+
+// reflectionClient 反射服务的客户端
+type reflectionClient struct {
+	ListServices func(ctx context.Context, req *ListServicesReq) (*ListServicesResp, error) `mrpc:"serializer=json"`
+}
+
+func (r reflectionClient) Name() string {
+	return ReflectionServiceName
+}
+
+// ListServices 通过反射服务查询服务端注册的服务和方法
+func (c *Client) ListServices(ctx context.Context) (*ListServicesResp, error) {
+	stub := &reflectionClient{}
+	if err := c.InitService(stub); err != nil {
+		return nil, err
+	}
+	return stub.ListServices(ctx, &ListServicesReq{})
+}
+
+type reflectionService struct {
+	server *Server
+}
+
+func (r *reflectionService) Name() string {
+	return ReflectionServiceName
+}
+
+func (r *reflectionService) ListServices(ctx context.Context, req *ListServicesReq) (*ListServicesResp, error) {
+	files := &fileCollector{seen: make(map[string]struct{}, 4)}
+	return &ListServicesResp{
+		Services:        r.server.serviceInfos(files),
+		FileDescriptors: files.files,
+	}, nil
+}
+
+// serviceInfos 返回所有服务的方法，按服务名排序
+func (s *Server) serviceInfos(files *fileCollector) []ServiceInfo {
+	res := make([]ServiceInfo, 0, len(s.services))
+	for name, stub := range s.services {
+		info := ServiceInfo{Name: name}
+		typ := stub.value.Type()
+		for i := 0; i < typ.NumMethod(); i++ {
+			methodTyp := stub.value.Method(i).Type()
+			if !checkFuncType(methodTyp) {
+				continue
+			}
+			in, out := methodTyp.In(1), methodTyp.Out(0)
+			info.Methods = append(info.Methods, MethodInfo{
+				Name:          typ.Method(i).Name,
+				Request:       in.String(),
+				Response:      out.String(),
+				RequestProto:  files.add(in),
+				ResponseProto: files.add(out),
+			})
+		}
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// fileCollector 收集 proto 消息所在的文件
+type fileCollector struct {
+	seen  map[string]struct{}
+	files [][]byte
+}
+
+// add 如果 typ 是 proto 消息，收集其所在的文件并返回消息全名
+func (f *fileCollector) add(typ reflect.Type) string {
+	msg, ok := reflect.New(typ.Elem()).Interface().(proto.Message)
+	if !ok {
+		return ""
+	}
+	desc := msg.ProtoReflect().Descriptor()
+	f.addFile(desc.ParentFile())
+	return string(desc.FullName())
+}
+
+func (f *fileCollector) addFile(fd protoreflect.FileDescriptor) {
+	if _, ok := f.seen[fd.Path()]; ok {
+		return
+	}
+	f.seen[fd.Path()] = struct{}{}
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		f.addFile(imports.Get(i).FileDescriptor)
+	}
+	data, err := proto.Marshal(protodesc.ToFileDescriptorProto(fd))
+	if err != nil {
+		return
+	}
+	f.files = append(f.files, data)
+}
@@ -0,0 +1,58 @@
+package mrpc
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/internal/proto/gen"
+	"github.com/NotFound1911/mrpc/serialize/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"testing"
+	"time"
+)
+
+func TestReflection(t *testing.T) {
+	server := NewServer(ServerWithReflection())
+	server.RegisterService(&UserServiceServer{})
+	go func() {
+		err := server.Start("tcp", ":8098")
+		t.Log("err:", err)
+	}()
+	time.Sleep(time.Second)
+
+	// 默认协议为 proto 时反射服务仍然使用 json
+	client, err := NewClient(":8098", ClientWithSerializer(&proto.Serializer{}))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := client.ListServices(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ServiceInfo{
+		{
+			Name: ReflectionServiceName,
+			Methods: []MethodInfo{
+				{Name: "ListServices", Request: "*mrpc.ListServicesReq", Response: "*mrpc.ListServicesResp"},
+			},
+		},
+		{
+			Name: "user-service",
+			Methods: []MethodInfo{
+				{Name: "GetById", Request: "*mrpc.GetByIdReq", Response: "*mrpc.GetByIdResp"},
+				{
+					Name:          "GetByIdProto",
+					Request:       "*gen.GetByIdReq",
+					Response:      "*gen.GetByIdResp",
+					RequestProto:  "users.GetByIdReq",
+					ResponseProto: "users.GetByIdResp",
+				},
+			},
+		},
+	}, resp.Services)
+
+	require.Len(t, resp.FileDescriptors, 1)
+	fd := &descriptorpb.FileDescriptorProto{}
+	require.NoError(t, protobuf.Unmarshal(resp.FileDescriptors[0], fd))
+	assert.Equal(t, gen.File_user_proto.Path(), fd.GetName())
+}
@@ -0,0 +1,525 @@
+package compact
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	errTruncated = errors.New("compact: 数据不完整")
+	errTooLarge  = errors.New("compact: 长度超出数据范围")
+
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// maxEmptyElems 元素编码结果为空的切片或 map 的最大长度
+const maxEmptyElems = 1 << 20
+
+type encodeFunc func(buf []byte, v reflect.Value) ([]byte, error)
+type decodeFunc func(d *decoder, v reflect.Value) error
+
+// typeCodec 某个类型预先生成的编解码函数
+type typeCodec struct {
+	enc encodeFunc
+	dec decodeFunc
+	// empty 编码结果总是为空，例如 struct{}
+	empty bool
+}
+
+// codecs 缓存每个类型的 typeCodec
+var codecs sync.Map
+
+// codecOf 获取类型的编解码函数，首次使用时生成
+func codecOf(typ reflect.Type) (*typeCodec, error) {
+	if c, ok := codecs.Load(typ); ok {
+		return c.(*typeCodec), nil
+	}
+	building := make(map[reflect.Type]*typeCodec, 4)
+	c, err := buildCodec(typ, building)
+	if err != nil {
+		return nil, err
+	}
+	for t, tc := range building {
+		codecs.LoadOrStore(t, tc)
+	}
+	actual, _ := codecs.LoadOrStore(typ, c)
+	return actual.(*typeCodec), nil
+}
+
+// buildCodec building 记录正在生成的类型，用于处理递归类型
+func buildCodec(typ reflect.Type, building map[reflect.Type]*typeCodec) (*typeCodec, error) {
+	if c, ok := codecs.Load(typ); ok {
+		return c.(*typeCodec), nil
+	}
+	if c, ok := building[typ]; ok {
+		// 递归引用，调用时 c 已经生成完毕
+		return c, nil
+	}
+	c := &typeCodec{}
+	building[typ] = c
+
+	if typ.Kind() != reflect.Pointer && typ.Implements(binaryMarshalerType) &&
+		reflect.PointerTo(typ).Implements(binaryUnmarshalerType) {
+		// 例如 time.Time
+		c.enc, c.dec = encodeBinaryMarshaler, decodeBinaryUnmarshaler
+		return c, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		c.enc, c.dec = encodeBool, decodeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c.enc, c.dec = encodeInt, decodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		c.enc, c.dec = encodeUint, decodeUint
+	case reflect.Float32:
+		c.enc, c.dec = encodeFloat32, decodeFloat32
+	case reflect.Float64:
+		c.enc, c.dec = encodeFloat64, decodeFloat64
+	case reflect.String:
+		c.enc, c.dec = encodeString, decodeString
+	case reflect.Pointer:
+		elem, err := buildCodec(typ.Elem(), building)
+		if err != nil {
+			return nil, err
+		}
+		c.enc, c.dec = pointerCodec(typ, elem)
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			c.enc, c.dec = encodeBytes, decodeBytes
+			break
+		}
+		elem, err := buildCodec(typ.Elem(), building)
+		if err != nil {
+			return nil, err
+		}
+		c.enc, c.dec = sliceCodec(typ, elem)
+	case reflect.Array:
+		elem, err := buildCodec(typ.Elem(), building)
+		if err != nil {
+			return nil, err
+		}
+		c.enc, c.dec = arrayCodec(elem)
+		c.empty = typ.Len() == 0 || elem.empty
+	case reflect.Map:
+		key, err := buildCodec(typ.Key(), building)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := buildCodec(typ.Elem(), building)
+		if err != nil {
+			return nil, err
+		}
+		c.enc, c.dec = mapCodec(typ, key, elem)
+	case reflect.Struct:
+		enc, dec, empty, err := structCodec(typ, building)
+		if err != nil {
+			return nil, err
+		}
+		c.enc, c.dec, c.empty = enc, dec, empty
+	default:
+		return nil, fmt.Errorf("compact: 不支持的类型 %s", typ)
+	}
+	return c, nil
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) byte() (byte, error) {
+	if len(d.data) < 1 {
+		return 0, errTruncated
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b, nil
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	val, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	d.data = d.data[n:]
+	return val, nil
+}
+
+func (d *decoder) varint() (int64, error) {
+	val, n := binary.Varint(d.data)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	d.data = d.data[n:]
+	return val, nil
+}
+
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if len(d.data) < n {
+		return nil, errTruncated
+	}
+	bs := d.data[:n]
+	d.data = d.data[n:]
+	return bs, nil
+}
+
+// length 读取长度，并保证数据中至少还有 length 个元素
+func (d *decoder) length() (int, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)) {
+		return 0, errTooLarge
+	}
+	return int(n), nil
+}
+
+// nullableLength 切片与 map 的长度，0 表示 nil，其余为长度加一
+// 元素编码后至少占用一个字节，因此长度不会超过剩余的数据
+// empty 表示元素编码结果为空，此时只能使用固定的上限
+func (d *decoder) nullableLength(empty bool) (int, bool, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, false, err
+	}
+	if n == 0 {
+		return 0, true, nil
+	}
+	limit := uint64(len(d.data))
+	if empty {
+		limit = maxEmptyElems
+	}
+	if n-1 > limit {
+		return 0, false, errTooLarge
+	}
+	return int(n - 1), false, nil
+}
+
+// appendNullableLength 写入切片与 map 的长度，与 nullableLength 对应
+// 元素编码结果为空时长度不能超过 maxEmptyElems，否则编码结果无法解码
+func appendNullableLength(buf []byte, n int, empty bool) ([]byte, error) {
+	if empty && n > maxEmptyElems {
+		return nil, fmt.Errorf("compact: 元素编码结果为空时长度 %d 超过上限 %d", n, maxEmptyElems)
+	}
+	return binary.AppendUvarint(buf, uint64(n)+1), nil
+}
+
+func encodeBool(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.Bool() {
+		return append(buf, 1), nil
+	}
+	return append(buf, 0), nil
+}
+
+func decodeBool(d *decoder, v reflect.Value) error {
+	b, err := d.byte()
+	if err != nil {
+		return err
+	}
+	v.SetBool(b != 0)
+	return nil
+}
+
+func encodeInt(buf []byte, v reflect.Value) ([]byte, error) {
+	return binary.AppendVarint(buf, v.Int()), nil
+}
+
+func decodeInt(d *decoder, v reflect.Value) error {
+	val, err := d.varint()
+	if err != nil {
+		return err
+	}
+	if v.OverflowInt(val) {
+		return fmt.Errorf("compact: %d 超出 %s 的范围", val, v.Type())
+	}
+	v.SetInt(val)
+	return nil
+}
+
+func encodeUint(buf []byte, v reflect.Value) ([]byte, error) {
+	return binary.AppendUvarint(buf, v.Uint()), nil
+}
+
+func decodeUint(d *decoder, v reflect.Value) error {
+	val, err := d.uvarint()
+	if err != nil {
+		return err
+	}
+	if v.OverflowUint(val) {
+		return fmt.Errorf("compact: %d 超出 %s 的范围", val, v.Type())
+	}
+	v.SetUint(val)
+	return nil
+}
+
+func encodeFloat32(buf []byte, v reflect.Value) ([]byte, error) {
+	return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v.Float()))), nil
+}
+
+func decodeFloat32(d *decoder, v reflect.Value) error {
+	bs, err := d.bytes(4)
+	if err != nil {
+		return err
+	}
+	v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(bs))))
+	return nil
+}
+
+func encodeFloat64(buf []byte, v reflect.Value) ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+}
+
+func decodeFloat64(d *decoder, v reflect.Value) error {
+	bs, err := d.bytes(8)
+	if err != nil {
+		return err
+	}
+	v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(bs)))
+	return nil
+}
+
+func encodeString(buf []byte, v reflect.Value) ([]byte, error) {
+	s := v.String()
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...), nil
+}
+
+func decodeString(d *decoder, v reflect.Value) error {
+	n, err := d.length()
+	if err != nil {
+		return err
+	}
+	bs, err := d.bytes(n)
+	if err != nil {
+		return err
+	}
+	v.SetString(string(bs))
+	return nil
+}
+
+func encodeBytes(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.IsNil() {
+		return append(buf, 0), nil
+	}
+	bs := v.Bytes()
+	buf = binary.AppendUvarint(buf, uint64(len(bs))+1)
+	return append(buf, bs...), nil
+}
+
+func decodeBytes(d *decoder, v reflect.Value) error {
+	n, isNil, err := d.nullableLength(false)
+	if err != nil || isNil {
+		return err
+	}
+	bs, err := d.bytes(n)
+	if err != nil {
+		return err
+	}
+	res := reflect.MakeSlice(v.Type(), n, n)
+	copy(res.Bytes(), bs)
+	v.Set(res)
+	return nil
+}
+
+func encodeBinaryMarshaler(buf []byte, v reflect.Value) ([]byte, error) {
+	bs, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(bs)))
+	return append(buf, bs...), nil
+}
+
+func decodeBinaryUnmarshaler(d *decoder, v reflect.Value) error {
+	n, err := d.length()
+	if err != nil {
+		return err
+	}
+	bs, err := d.bytes(n)
+	if err != nil {
+		return err
+	}
+	return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(bs)
+}
+
+func pointerCodec(typ reflect.Type, elem *typeCodec) (encodeFunc, decodeFunc) {
+	enc := func(buf []byte, v reflect.Value) ([]byte, error) {
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return elem.enc(append(buf, 1), v.Elem())
+	}
+	dec := func(d *decoder, v reflect.Value) error {
+		b, err := d.byte()
+		if err != nil {
+			return err
+		}
+		if b == 0 {
+			v.Set(reflect.Zero(typ))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(typ.Elem()))
+		}
+		return elem.dec(d, v.Elem())
+	}
+	return enc, dec
+}
+
+func sliceCodec(typ reflect.Type, elem *typeCodec) (encodeFunc, decodeFunc) {
+	enc := func(buf []byte, v reflect.Value) ([]byte, error) {
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		n := v.Len()
+		buf, err := appendNullableLength(buf, n, elem.empty)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			if buf, err = elem.enc(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	dec := func(d *decoder, v reflect.Value) error {
+		n, isNil, err := d.nullableLength(elem.empty)
+		if err != nil {
+			return err
+		}
+		if isNil {
+			v.Set(reflect.Zero(typ))
+			return nil
+		}
+		res := reflect.MakeSlice(typ, n, n)
+		for i := 0; i < n; i++ {
+			if err = elem.dec(d, res.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(res)
+		return nil
+	}
+	return enc, dec
+}
+
+func arrayCodec(elem *typeCodec) (encodeFunc, decodeFunc) {
+	enc := func(buf []byte, v reflect.Value) ([]byte, error) {
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if buf, err = elem.enc(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	dec := func(d *decoder, v reflect.Value) error {
+		for i := 0; i < v.Len(); i++ {
+			if err := elem.dec(d, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return enc, dec
+}
+
+func mapCodec(typ reflect.Type, key, elem *typeCodec) (encodeFunc, decodeFunc) {
+	enc := func(buf []byte, v reflect.Value) ([]byte, error) {
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf, err := appendNullableLength(buf, v.Len(), key.empty && elem.empty)
+		if err != nil {
+			return nil, err
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if buf, err = key.enc(buf, iter.Key()); err != nil {
+				return nil, err
+			}
+			if buf, err = elem.enc(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	dec := func(d *decoder, v reflect.Value) error {
+		n, isNil, err := d.nullableLength(key.empty && elem.empty)
+		if err != nil {
+			return err
+		}
+		if isNil {
+			v.Set(reflect.Zero(typ))
+			return nil
+		}
+		res := reflect.MakeMapWithSize(typ, n)
+		for i := 0; i < n; i++ {
+			k := reflect.New(typ.Key()).Elem()
+			if err = key.dec(d, k); err != nil {
+				return err
+			}
+			e := reflect.New(typ.Elem()).Elem()
+			if err = elem.dec(d, e); err != nil {
+				return err
+			}
+			res.SetMapIndex(k, e)
+		}
+		v.Set(res)
+		return nil
+	}
+	return enc, dec
+}
+
+type fieldCodec struct {
+	index int
+	codec *typeCodec
+}
+
+// structCodec 按字段声明顺序编码所有导出字段，不写入字段名
+// 带有 mrpc:"-" 标签的字段会被忽略
+// 所有字段的编码结果都为空时，结构体的编码结果也为空
+func structCodec(typ reflect.Type, building map[reflect.Type]*typeCodec) (encodeFunc, decodeFunc, bool, error) {
+	fields := make([]fieldCodec, 0, typ.NumField())
+	empty := true
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() || strings.TrimSpace(field.Tag.Get("mrpc")) == "-" {
+			continue
+		}
+		c, err := buildCodec(field.Type, building)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("compact: 字段 %s.%s: %w", typ, field.Name, err)
+		}
+		fields = append(fields, fieldCodec{index: i, codec: c})
+		// 递归引用只能经过指针、切片或 map，它们的 empty 在生成时已经确定
+		empty = empty && c.empty
+	}
+	enc := func(buf []byte, v reflect.Value) ([]byte, error) {
+		var err error
+		for _, f := range fields {
+			if buf, err = f.codec.enc(buf, v.Field(f.index)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	dec := func(d *decoder, v reflect.Value) error {
+		for _, f := range fields {
+			if err := f.codec.dec(d, v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return enc, dec, empty, nil
+}
@@ -0,0 +1,66 @@
+package compact
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Serializer 紧凑的二进制编码，只适用于 Go 服务之间的调用
+// 每个类型的编解码函数在首次使用时通过反射生成并缓存
+// 消息中不包含字段名和类型信息，调用双方必须使用相同的结构体定义
+type Serializer struct {
+}
+
+func (s Serializer) Name() string {
+	return "compact"
+}
+
+func (s Serializer) Code() uint8 {
+	return 5
+}
+
+func (s Serializer) Encode(val any) ([]byte, error) {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, errors.New("compact: 不支持 nil")
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, errors.New("compact: 不支持 nil")
+	}
+	c, err := codecOf(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	return c.enc(make([]byte, 0, 64), v)
+}
+
+// Decode val 必须是非 nil 指针
+func (s Serializer) Decode(data []byte, val any) error {
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return errors.New("compact: 只支持非 nil 指针")
+	}
+	v = v.Elem()
+	// 与 Encode 保持一致，多级指针解引用到最终的值
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	c, err := codecOf(v.Type())
+	if err != nil {
+		return err
+	}
+	d := &decoder{data: data}
+	if err = c.dec(d, v); err != nil {
+		return err
+	}
+	if len(d.data) != 0 {
+		return errors.New("compact: 数据有多余的字节")
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package compact
+
+import (
+	"errors"
+	"github.com/NotFound1911/mrpc/serialize/gob"
+	"github.com/NotFound1911/mrpc/serialize/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type GetByIdReq struct {
+	Id int64
+}
+
+type User struct {
+	Id        int64
+	Name      string
+	Age       uint8
+	Score     float64
+	Ratio     float32
+	Vip       bool
+	Avatar    []byte
+	Tags      []string
+	Attrs     map[string]int
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+	Friend    *User
+	Position  [2]int
+	Password  string `mrpc:"-"`
+	internal  string
+}
+
+type Node struct {
+	Val      int
+	Children []*Node
+}
+
+// EmptyElems 元素编码结果为空的切片与 map
+type EmptyElems struct {
+	Structs []struct{}
+	Arrays  [][0]int
+	Set     map[struct{}]struct{}
+}
+
+func TestSerializer(t *testing.T) {
+	now := time.Date(2023, 12, 1, 10, 0, 0, 123, time.UTC)
+	testCases := []struct {
+		name    string
+		val     any
+		newRes  func() any
+		wantRes any
+	}{
+		{
+			name:    "simple",
+			val:     &GetByIdReq{Id: 123},
+			newRes:  func() any { return &GetByIdReq{} },
+			wantRes: &GetByIdReq{Id: 123},
+		},
+		{
+			name:    "negative",
+			val:     &GetByIdReq{Id: -123},
+			newRes:  func() any { return &GetByIdReq{} },
+			wantRes: &GetByIdReq{Id: -123},
+		},
+		{
+			name: "all kinds",
+			val: &User{
+				Id:        123,
+				Name:      "Tom",
+				Age:       18,
+				Score:     99.5,
+				Ratio:     0.5,
+				Vip:       true,
+				Avatar:    []byte{0x00, 0xff},
+				Tags:      []string{"a", "", "c"},
+				Attrs:     map[string]int{"level": 3},
+				CreatedAt: now,
+				UpdatedAt: &now,
+				Friend:    &User{Id: 456, Tags: []string{}},
+				Position:  [2]int{1, -1},
+				Password:  "123456",
+				internal:  "internal",
+			},
+			newRes: func() any { return &User{} },
+			wantRes: &User{
+				Id:        123,
+				Name:      "Tom",
+				Age:       18,
+				Score:     99.5,
+				Ratio:     0.5,
+				Vip:       true,
+				Avatar:    []byte{0x00, 0xff},
+				Tags:      []string{"a", "", "c"},
+				Attrs:     map[string]int{"level": 3},
+				CreatedAt: now,
+				UpdatedAt: &now,
+				Friend:    &User{Id: 456, Tags: []string{}},
+				Position:  [2]int{1, -1},
+			},
+		},
+		{
+			name: "recursive",
+			val: &Node{
+				Val:      1,
+				Children: []*Node{{Val: 2}, nil, {Val: 3, Children: []*Node{{Val: 4}}}},
+			},
+			newRes: func() any { return &Node{} },
+			wantRes: &Node{
+				Val:      1,
+				Children: []*Node{{Val: 2}, nil, {Val: 3, Children: []*Node{{Val: 4}}}},
+			},
+		},
+		{
+			name:    "map",
+			val:     map[int64]*GetByIdReq{1: {Id: 1}, 2: nil},
+			newRes:  func() any { return &map[int64]*GetByIdReq{} },
+			wantRes: &map[int64]*GetByIdReq{1: {Id: 1}, 2: nil},
+		},
+		{
+			name:    "empty elements",
+			val:     &EmptyElems{Structs: []struct{}{{}, {}}, Arrays: [][0]int{{}, {}, {}}, Set: map[struct{}]struct{}{{}: {}}},
+			newRes:  func() any { return &EmptyElems{} },
+			wantRes: &EmptyElems{Structs: []struct{}{{}, {}}, Arrays: [][0]int{{}, {}, {}}, Set: map[struct{}]struct{}{{}: {}}},
+		},
+	}
+	s := Serializer{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := s.Encode(tc.val)
+			require.NoError(t, err)
+			res := tc.newRes()
+			require.NoError(t, s.Decode(data, res))
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestSerializer_Error(t *testing.T) {
+	s := Serializer{}
+	testCases := []struct {
+		name    string
+		encode  func() error
+		wantErr error
+	}{
+		{
+			name: "nil",
+			encode: func() error {
+				_, err := s.Encode((*GetByIdReq)(nil))
+				return err
+			},
+			wantErr: errors.New("compact: 不支持 nil"),
+		},
+		{
+			name: "unsupported type",
+			encode: func() error {
+				_, err := s.Encode(&struct{ Fn func() }{})
+				return err
+			},
+			wantErr: errors.New("compact: 字段 struct { Fn func() }.Fn: compact: 不支持的类型 func()"),
+		},
+		{
+			name: "decode not pointer",
+			encode: func() error {
+				return s.Decode([]byte{0}, GetByIdReq{})
+			},
+			wantErr: errors.New("compact: 只支持非 nil 指针"),
+		},
+		{
+			name: "truncated",
+			encode: func() error {
+				data, err := s.Encode(&User{Name: "Tom"})
+				require.NoError(t, err)
+				return s.Decode(data[:len(data)-2], &User{})
+			},
+			wantErr: errTruncated,
+		},
+		{
+			name: "length too large",
+			encode: func() error {
+				return s.Decode([]byte{0xff, 0xff, 0x03}, new(string))
+			},
+			wantErr: errTooLarge,
+		},
+		{
+			name: "empty elements too many",
+			encode: func() error {
+				return s.Decode([]byte{0x82, 0x80, 0x40}, &[]struct{}{})
+			},
+			wantErr: errTooLarge,
+		},
+		{
+			name: "encode empty elements too many",
+			encode: func() error {
+				_, err := s.Encode(&EmptyElems{Structs: make([]struct{}, maxEmptyElems+1)})
+				return err
+			},
+			wantErr: errors.New("compact: 元素编码结果为空时长度 1048577 超过上限 1048576"),
+		},
+		{
+			name: "trailing bytes",
+			encode: func() error {
+				return s.Decode([]byte{0x02, 0x00}, &GetByIdReq{})
+			},
+			wantErr: errors.New("compact: 数据有多余的字节"),
+		},
+		{
+			name: "overflow",
+			encode: func() error {
+				data, err := s.Encode(&struct{ Val int64 }{Val: 1000})
+				require.NoError(t, err)
+				return s.Decode(data, &struct{ Val int8 }{})
+			},
+			wantErr: errors.New("compact: 1000 超出 int8 的范围"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.EqualError(t, tc.encode(), tc.wantErr.Error())
+		})
+	}
+}
+
+type benchSerializer interface {
+	Encode(val any) ([]byte, error)
+	Decode(data []byte, val any) error
+}
+
+var benchSerializers = []struct {
+	name string
+	s    benchSerializer
+}{
+	{name: "compact", s: Serializer{}},
+	{name: "json", s: json.Serializer{}},
+	{name: "gob", s: gob.Serializer{}},
+}
+
+var benchUser = &User{
+	Id:        123,
+	Name:      "Tom",
+	Age:       18,
+	Score:     99.5,
+	Vip:       true,
+	Avatar:    make([]byte, 64),
+	Tags:      []string{"a", "b", "c"},
+	Attrs:     map[string]int{"level": 3},
+	CreatedAt: time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC),
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, bm := range benchSerializers {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				data, err := bm.s.Encode(benchUser)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/msg")
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, bm := range benchSerializers {
+		b.Run(bm.name, func(b *testing.B) {
+			data, err := bm.s.Encode(benchUser)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err = bm.s.Decode(data, &User{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Serializer 使用 encoding/gob 编码，只适用于 Go 服务之间的调用
+// 每条消息都会携带类型信息
+type Serializer struct {
+}
+
+func (s Serializer) Name() string {
+	return "gob"
+}
+
+func (s Serializer) Code() uint8 {
+	return 4
+}
+
+func (s Serializer) Encode(val any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s Serializer) Decode(data []byte, val any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(val)
+}
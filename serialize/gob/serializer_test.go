@@ -0,0 +1,38 @@
+package gob
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type GetByIdReq struct {
+	Id   int64
+	Tags []string
+}
+
+func TestSerializer(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  *GetByIdReq
+	}{
+		{
+			name: "normal",
+			val:  &GetByIdReq{Id: 123, Tags: []string{"a", "b"}},
+		},
+		{
+			name: "zero",
+			val:  &GetByIdReq{},
+		},
+	}
+	s := Serializer{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := s.Encode(tc.val)
+			require.NoError(t, err)
+			res := &GetByIdReq{}
+			require.NoError(t, s.Decode(data, res))
+			assert.Equal(t, tc.val, res)
+		})
+	}
+}
@@ -5,6 +5,10 @@ import "encoding/json"
 type Serializer struct {
 }
 
+func (s Serializer) Name() string {
+	return "json"
+}
+
 func (s Serializer) Code() uint8 {
 	return 1
 }
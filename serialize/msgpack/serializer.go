@@ -0,0 +1,41 @@
+package msgpack
+
+import (
+	"bytes"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Serializer 使用 MessagePack 编码
+// 字段名优先取 msgpack 标签，没有时使用 json 标签
+// time.Time 使用 MessagePack 时间扩展类型，[]byte 使用二进制类型，不会再做 base64
+type Serializer struct {
+}
+
+func (s Serializer) Name() string {
+	return "msgpack"
+}
+
+func (s Serializer) Code() uint8 {
+	return 3
+}
+
+func (s Serializer) Encode(val any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+	enc.Reset(buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s Serializer) Decode(data []byte, val any) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(val)
+}
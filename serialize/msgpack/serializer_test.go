@@ -0,0 +1,142 @@
+package msgpack
+
+import (
+	"github.com/NotFound1911/mrpc/serialize/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Id        int64     `msgpack:"id"`
+	Name      string    `json:"name"`
+	Password  string    `msgpack:"-"`
+	Avatar    []byte    `msgpack:"avatar"`
+	CreatedAt time.Time `msgpack:"created_at"`
+	Tags      []string  `msgpack:"tags,omitempty"`
+}
+
+func TestSerializer(t *testing.T) {
+	testCases := []struct {
+		name    string
+		val     *User
+		wantRes *User
+	}{
+		{
+			name: "normal",
+			val: &User{
+				Id:        123,
+				Name:      "Tom",
+				Avatar:    []byte{0x00, 0xff, 0x10},
+				CreatedAt: time.Date(2023, 12, 1, 10, 0, 0, 123, time.UTC),
+				Tags:      []string{"a", "b"},
+			},
+			wantRes: &User{
+				Id:        123,
+				Name:      "Tom",
+				Avatar:    []byte{0x00, 0xff, 0x10},
+				CreatedAt: time.Date(2023, 12, 1, 10, 0, 0, 123, time.UTC),
+				Tags:      []string{"a", "b"},
+			},
+		},
+		{
+			name: "ignored field",
+			val: &User{
+				Id:       123,
+				Password: "123456",
+			},
+			wantRes: &User{
+				Id: 123,
+			},
+		},
+	}
+	s := Serializer{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := s.Encode(tc.val)
+			require.NoError(t, err)
+			res := &User{}
+			err = s.Decode(data, res)
+			require.NoError(t, err)
+			// 时间解码后为本地时区
+			assert.True(t, tc.wantRes.CreatedAt.Equal(res.CreatedAt))
+			res.CreatedAt = tc.wantRes.CreatedAt
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestSerializer_Tags(t *testing.T) {
+	s := Serializer{}
+	data, err := s.Encode(&User{Id: 1, Name: "Tom"})
+	require.NoError(t, err)
+	res := map[string]any{}
+	require.NoError(t, s.Decode(data, &res))
+	assert.Contains(t, res, "id")
+	assert.Contains(t, res, "name")
+	assert.NotContains(t, res, "Password")
+	assert.NotContains(t, res, "tags")
+}
+
+var benchUser = &User{
+	Id:        123,
+	Name:      "Tom",
+	Avatar:    make([]byte, 256),
+	CreatedAt: time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC),
+	Tags:      []string{"a", "b", "c"},
+}
+
+func BenchmarkEncode(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		s    interface {
+			Encode(val any) ([]byte, error)
+		}
+	}{
+		{name: "msgpack", s: Serializer{}},
+		{name: "json", s: json.Serializer{}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				data, err := bm.s.Encode(benchUser)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/msg")
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		s    interface {
+			Encode(val any) ([]byte, error)
+			Decode(data []byte, val any) error
+		}
+	}{
+		{name: "msgpack", s: Serializer{}},
+		{name: "json", s: json.Serializer{}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			data, err := bm.s.Encode(benchUser)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err = bm.s.Decode(data, &User{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
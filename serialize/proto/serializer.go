@@ -8,6 +8,10 @@ import (
 type Serializer struct {
 }
 
+func (s Serializer) Name() string {
+	return "proto"
+}
+
 func (s Serializer) Code() uint8 {
 	return 2
 }
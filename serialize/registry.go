@@ -0,0 +1,71 @@
+package serialize
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry 按名字和编号管理序列化协议
+type Registry struct {
+	mutex  sync.RWMutex
+	byCode map[uint8]Serializer
+	byName map[string]Serializer
+}
+
+func NewRegistry(sls ...Serializer) (*Registry, error) {
+	res := &Registry{
+		byCode: make(map[uint8]Serializer, 4),
+		byName: make(map[string]Serializer, 4),
+	}
+	for _, sl := range sls {
+		if err := res.Register(sl); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Register 注册序列化协议
+// 编号或名字已经被其他协议占用时返回错误，重复注册同一个协议不会报错
+func (r *Registry) Register(sl Serializer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if old, ok := r.byCode[sl.Code()]; ok && old.Name() != sl.Name() {
+		return fmt.Errorf("serialize: 编号 %d 已经被 %s 使用，无法注册 %s", sl.Code(), old.Name(), sl.Name())
+	}
+	if old, ok := r.byName[sl.Name()]; ok && old.Code() != sl.Code() {
+		return fmt.Errorf("serialize: 名字 %s 已经被编号 %d 使用，无法注册编号 %d", sl.Name(), old.Code(), sl.Code())
+	}
+	r.byCode[sl.Code()] = sl
+	r.byName[sl.Name()] = sl
+	return nil
+}
+
+func (r *Registry) ByCode(code uint8) (Serializer, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	sl, ok := r.byCode[code]
+	return sl, ok
+}
+
+func (r *Registry) ByName(name string) (Serializer, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	sl, ok := r.byName[name]
+	return sl, ok
+}
+
+// Serializers 返回所有协议，按编号排序
+func (r *Registry) Serializers() []Serializer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	res := make([]Serializer, 0, len(r.byCode))
+	for _, sl := range r.byCode {
+		res = append(res, sl)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Code() < res[j].Code()
+	})
+	return res
+}
@@ -0,0 +1,84 @@
+package serialize
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type mockSerializer struct {
+	name string
+	code uint8
+}
+
+func (m mockSerializer) Name() string {
+	return m.name
+}
+
+func (m mockSerializer) Code() uint8 {
+	return m.code
+}
+
+func (m mockSerializer) Encode(val any) ([]byte, error) {
+	return nil, nil
+}
+
+func (m mockSerializer) Decode(data []byte, val any) error {
+	return nil
+}
+
+func TestRegistry_Register(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sl      Serializer
+		wantErr error
+	}{
+		{
+			name: "new",
+			sl:   mockSerializer{name: "msgpack", code: 3},
+		},
+		{
+			name: "same serializer",
+			sl:   mockSerializer{name: "json", code: 1},
+		},
+		{
+			name:    "code collision",
+			sl:      mockSerializer{name: "xml", code: 1},
+			wantErr: errors.New("serialize: 编号 1 已经被 json 使用，无法注册 xml"),
+		},
+		{
+			name:    "name collision",
+			sl:      mockSerializer{name: "json", code: 9},
+			wantErr: errors.New("serialize: 名字 json 已经被编号 1 使用，无法注册编号 9"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRegistry(mockSerializer{name: "json", code: 1})
+			require.NoError(t, err)
+			err = r.Register(tc.sl)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			sl, ok := r.ByName(tc.sl.Name())
+			assert.True(t, ok)
+			assert.Equal(t, tc.sl, sl)
+			sl, ok = r.ByCode(tc.sl.Code())
+			assert.True(t, ok)
+			assert.Equal(t, tc.sl, sl)
+		})
+	}
+}
+
+func TestRegistry_Serializers(t *testing.T) {
+	r, err := NewRegistry(mockSerializer{name: "proto", code: 2}, mockSerializer{name: "json", code: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []Serializer{
+		mockSerializer{name: "json", code: 1},
+		mockSerializer{name: "proto", code: 2},
+	}, r.Serializers())
+	_, ok := r.ByName("xml")
+	assert.False(t, ok)
+}
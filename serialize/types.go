@@ -1,6 +1,9 @@
 package serialize
 
 type Serializer interface {
+	// Name 序列化协议的名字，用于按名字查找，例如 json
+	Name() string
+	// Code 写入请求头部的协议编号
 	Code() uint8
 	Encode(val any) ([]byte, error)
 	// Decode val是结构体指针
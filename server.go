@@ -2,68 +2,247 @@ package mrpc
 
 import (
 	"context"
+	"encoding/binary"
 	"github.com/NotFound1911/mrpc/serialize/json"
-	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"errors"
 	"github.com/NotFound1911/mrpc/message"
 	"github.com/NotFound1911/mrpc/serialize"
+	"github.com/NotFound1911/mrpc/status"
 	"net"
 	"reflect"
 )
 
+// ErrServerClosed 调用 Shutdown 之后 Start 返回该错误
+var ErrServerClosed = errors.New("mrpc: 服务端已关闭")
+
 type Server struct {
-	services    map[string]reflectionStub
-	serializers map[uint8]serialize.Serializer
+	services     map[string]reflectionStub
+	registry     *serialize.Registry
+	interceptors []Interceptor
+	handler      HandleFunc
+	health       *healthState
+	stats        *serverStats
+	limits       msgLimits
+
+	mutex    sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]*serverConn
+	closed   atomic.Bool
+	// inflight 正在处理的请求数
+	inflight atomic.Int64
+}
+
+type ServerOption func(server *Server)
+
+// ServerWithInterceptors 设置服务端拦截器
+func ServerWithInterceptors(interceptors ...Interceptor) ServerOption {
+	return func(server *Server) {
+		server.interceptors = append(server.interceptors, interceptors...)
+	}
 }
 
-func NewServer() *Server {
+// ServerWithMaxRecvSize 设置能够接收的最大请求，默认为 DefaultMaxRecvSize，为 0 表示不限制
+// 超过限制时请求不会被处理，返回 ResourceExhausted
+func ServerWithMaxRecvSize(size int) ServerOption {
+	return func(server *Server) {
+		server.limits.maxRecv = size
+	}
+}
+
+// ServerWithMaxSendSize 设置能够发送的最大响应，默认不限制
+// 超过限制时返回 ResourceExhausted
+func ServerWithMaxSendSize(size int) ServerOption {
+	return func(server *Server) {
+		server.limits.maxSend = size
+	}
+}
+
+// ServerWithChunkSize 超过 size 的响应拆分成多个分块帧发送，客户端会还原成完整的响应
+// 分块只改变传输方式，两端仍然在内存中持有完整的响应，大小仍然受 ServerWithMaxSendSize 和 ClientWithMaxRecvSize 限制
+// 默认不分块
+func ServerWithChunkSize(size int) ServerOption {
+	return func(server *Server) {
+		server.limits.chunkSize = size
+	}
+}
+
+func NewServer(opts ...ServerOption) *Server {
+	// 只有一个协议，不会冲突
+	registry, _ := serialize.NewRegistry(&json.Serializer{})
 	res := &Server{
-		services:    make(map[string]reflectionStub, 16),
-		serializers: make(map[uint8]serialize.Serializer, 4),
+		services: make(map[string]reflectionStub, 16),
+		registry: registry,
+		health:   newHealthState(),
+		stats:    newServerStats(),
+		conns:    make(map[net.Conn]*serverConn, 16),
+		limits:   defaultMsgLimits(),
 	}
-	res.RegisterSerializer(&json.Serializer{})
+	for _, opt := range opts {
+		opt(res)
+	}
+	res.handler = chainInterceptors(res.invoke, res.interceptors)
 	return res
 }
-func (s *Server) RegisterSerializer(sl serialize.Serializer) {
-	s.serializers[sl.Code()] = sl
+
+// serializerNames 服务端支持的协议名字，以逗号分隔
+func (s *Server) serializerNames() string {
+	sls := s.registry.Serializers()
+	names := make([]string, 0, len(sls))
+	for _, sl := range sls {
+		names = append(names, sl.Name())
+	}
+	return strings.Join(names, ",")
 }
+
+// RegisterSerializer 注册序列化协议，编号或名字冲突时返回错误
+func (s *Server) RegisterSerializer(sl serialize.Serializer) error {
+	return s.registry.Register(sl)
+}
+
+// RegisterService 注册服务，服务的健康状态为 SERVING
 func (s *Server) RegisterService(service Service) {
 	s.services[service.Name()] = reflectionStub{
-		s:           service,
-		value:       reflect.ValueOf(service),
-		serializers: s.serializers,
+		s:        service,
+		value:    reflect.ValueOf(service),
+		registry: s.registry,
 	}
+	s.health.set(service.Name(), HealthServing)
 }
 
 func (s *Server) Start(network, addr string) error {
+	if s.closed.Load() {
+		return ErrServerClosed
+	}
 	listener, err := net.Listen(network, addr)
 	if err != nil {
 		return err
 	}
+	s.mutex.Lock()
+	s.listener = listener
+	s.mutex.Unlock()
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if s.closed.Load() {
+				return ErrServerClosed
+			}
 			return err
 		}
+		sc, ok := s.trackConn(conn)
+		if !ok {
+			conn.Close()
+			return ErrServerClosed
+		}
 		go func() {
-			if errConn := s.handleConn(conn); errConn != nil {
+			defer s.untrackConn(conn)
+			if errConn := s.handleConn(conn, sc); errConn != nil {
 				conn.Close()
 			}
 		}()
 	}
 }
+
+// trackConn 记录连接，服务端已关闭时无法记录新的连接
+func (s *Server) trackConn(conn net.Conn) (*serverConn, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed.Load() {
+		return nil, false
+	}
+	sc := &serverConn{peer: conn.RemoteAddr().String(), since: time.Now()}
+	s.conns[conn] = sc
+	return sc, true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, conn)
+}
+
+// Shutdown 关闭服务端
+// 健康状态变为 DRAINING，不再接收新的连接，等待正在处理的请求完成后关闭所有连接
+// ctx 结束时不再等待，直接关闭所有连接并返回 ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closed.Store(true)
+	s.health.drain()
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mutex.Unlock()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.inflight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			s.closeConns()
+			return err
+		case <-ticker.C:
+		}
+	}
+	s.closeConns()
+	return err
+}
+
+func (s *Server) closeConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+		delete(s.conns, conn)
+	}
+}
 func (s *Server) Invoke(ctx context.Context, req *message.Request) (*message.Response, error) {
-	service, ok := s.services[req.ServiceName]
-	resp := &message.Response{
+	ctx = ctxWithIncomingMeta(ctx, req.Meta)
+	ctx, _ = ctxWithPayload(ctx)
+	ctx, t := ctxWithTrailer(ctx)
+	call := s.stats.begin(ctx, req.ServiceName, req.MethodName, req.RequestID)
+	resp, err := s.handler(ctx, req)
+	s.stats.end(call, err)
+	if resp == nil {
+		// 拦截器拒绝了请求
+		resp = newResponse(req)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for k, v := range t.meta {
+		if resp.Meta == nil {
+			resp.Meta = make(map[string]string, len(t.meta))
+		}
+		resp.Meta[k] = v
+	}
+	return resp, err
+}
+func newResponse(req *message.Request) *message.Response {
+	return &message.Response{
 		RequestID:  req.RequestID,
 		Version:    req.Version,
 		Compresser: req.Compresser,
 		Serializer: req.Serializer,
 	}
+}
+func (s *Server) invoke(ctx context.Context, req *message.Request) (*message.Response, error) {
+	if req.ServiceName == BatchServiceName {
+		return s.invokeBatch(ctx, req)
+	}
+	service, ok := s.services[req.ServiceName]
+	resp := newResponse(req)
 	if !ok {
-		return resp, errors.New("调用的服务不存在")
+		return resp, status.New(status.Unimplemented, "调用的服务不存在")
+	}
+	if _, ok = s.registry.ByCode(req.Serializer); !ok {
+		// 告知客户端服务端支持的协议，客户端可以据此切换
+		resp.Meta = map[string]string{metaSerializers: s.serializerNames()}
+		return resp, status.New(status.Unimplemented, "unsupported serialization protocol")
 	}
 
 	respData, err := service.invoke(ctx, req)
@@ -78,60 +257,109 @@ func (s *Server) Invoke(ctx context.Context, req *message.Request) (*message.Res
 // part1. 长度字段，用固定字节表示
 // part2. 请求数据
 // 响应也是这个规范
-func (s *Server) handleConn(conn net.Conn) error {
+func (s *Server) handleConn(conn net.Conn, sc *serverConn) error {
 	for {
-		reqBs, err := ReadMsg(conn)
-		if err != nil {
-			return err
+		reqBs, readErr := readMsg(conn, s.limits.maxRecv, message.ValidReq)
+		if reqBs == nil {
+			return readErr
 		}
 		// 还原调用信息
-		req := message.DecodeReq(reqBs)
-		if err != nil {
-			return err
-		}
-		ctx := context.Background()
-		cancel := func() {}
-		if deadlinStr, ok := req.Meta["deadline"]; ok {
-			if deadline, er := strconv.ParseInt(deadlinStr, 10, 64); er == nil {
-				ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(deadline))
+		var req *message.Request
+		if readErr == nil && !message.VerifyReq(reqBs) {
+			// 变长部分可能已经损坏，只使用固定部分回复 DataLoss
+			if req = decodeFixedReq(reqBs); req == nil {
+				return errBadFrame
 			}
+			readErr = status.New(status.DataLoss, "请求校验和不匹配")
+		} else {
+			req = message.DecodeReq(reqBs)
 		}
-		cancel()
-		oneway, ok := req.Meta["one-way"]
+		ctx := ctxWithPeer(context.Background(), conn.RemoteAddr().String())
+		ctx, cancel := ctxWithMetaDeadline(ctx, req.Meta)
+		oneway, ok := req.Meta[metaOneway]
 		if ok && oneway == "true" {
 			ctx = CtxWithOneway(ctx)
 		}
-		resp, err := s.Invoke(ctx, req)
+		// 响应写回之后请求才算处理完，Shutdown 依赖该计数关闭连接
+		s.inflight.Add(1)
+		err := s.reply(ctx, conn, req, readErr)
+		s.inflight.Add(-1)
+		sc.requests.Add(1)
+		cancel()
 		if err != nil {
-			// 处理业务 error
-			resp.Error = []byte(err.Error())
+			return err
 		}
+	}
+}
+
+// decodeFixedReq 只解析请求头部的固定部分，长度不够时返回 nil
+func decodeFixedReq(data []byte) *message.Request {
+	if len(data) < 15 {
+		return nil
+	}
+	return &message.Request{
+		RequestID:  binary.BigEndian.Uint32(data[8:12]),
+		Version:    data[12],
+		Compresser: data[13],
+		Serializer: data[14],
+	}
+}
+
+// reply 处理请求并写回响应，readErr 不为 nil 时请求没有完整读取，直接以该错误响应
+func (s *Server) reply(ctx context.Context, conn net.Conn, req *message.Request, readErr error) error {
+	var (
+		resp *message.Response
+		err  error
+	)
+	if s.closed.Load() {
+		resp, err = newResponse(req), status.New(status.Unavailable, "服务端正在关闭")
+	} else if readErr != nil {
+		resp, err = newResponse(req), readErr
+	} else {
+		resp, err = s.Invoke(ctx, req)
+	}
+	if err != nil {
+		// 处理业务 error
+		resp.Status = uint8(status.CodeOf(err))
+		resp.Error = []byte(status.MessageOf(err))
+	}
+	if isOneway(ctx) {
+		// 客户端不会读取 oneway 调用的响应，写回的话会被下一次调用读到
+		return nil
+	}
+	resp.CalHeaderLength()
+	resp.CalBodyLength()
+	data := message.EncodeResp(resp)
+	if err = s.limits.checkSend(len(data)); err != nil {
+		resp = newResponse(req)
+		resp.Status = uint8(status.CodeOf(err))
+		resp.Error = []byte(status.MessageOf(err))
 		resp.CalHeaderLength()
 		resp.CalBodyLength()
-
-		if _, err = conn.Write(message.EncodeResp(resp)); err != nil {
-			return err
-		}
+		data = message.EncodeResp(resp)
 	}
-	return nil
+	return writeMsg(conn, data, s.limits.chunkSize)
 }
 
 type reflectionStub struct {
-	s           Service
-	value       reflect.Value
-	serializers map[uint8]serialize.Serializer
+	s        Service
+	value    reflect.Value
+	registry *serialize.Registry
 }
 
 func (s *reflectionStub) invoke(ctx context.Context, req *message.Request) ([]byte, error) {
 	// 反射找到方法 并执行调用
 	// s.value是通过反射保存的结构体 MethodByName是结构体的方法
 	method := s.value.MethodByName(req.MethodName)
+	if !method.IsValid() || method.Type().NumIn() != 2 || method.Type().NumOut() != 2 {
+		return nil, status.New(status.Unimplemented, "调用的方法不存在")
+	}
 	in := make([]reflect.Value, 2)
 
 	in[0] = reflect.ValueOf(ctx)
 	inReq := reflect.New(method.Type().In(1).Elem())
 	// 解析请求
-	serializer, ok := s.serializers[req.Serializer]
+	serializer, ok := s.registry.ByCode(req.Serializer)
 	if !ok {
 		return nil, errors.New("unsupported serialization protocol")
 	}
@@ -142,6 +370,9 @@ func (s *reflectionStub) invoke(ctx context.Context, req *message.Request) ([]by
 	// 第二个参数是根据方法的输入参数类型动态创建的指针类型的值，它会被用来接收传入的数据
 	in[1] = inReq
 	results := method.Call(in) // 调用结构体方法
+	if payload, ok := PayloadFromCtx(ctx); ok {
+		payload.set(inReq.Interface(), results[0].Interface())
+	}
 	// results[0] 返回值
 	// results[1] error
 	if results[1].Interface() != nil {
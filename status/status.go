@@ -0,0 +1,129 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/NotFound1911/mrpc/message"
+)
+
+// Code 调用状态码，取值与 gRPC 保持一致
+type Code uint8
+
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+var codeNames = [...]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Aborted:            "Aborted",
+	OutOfRange:         "OutOfRange",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DataLoss:           "DataLoss",
+	Unauthenticated:    "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return fmt.Sprintf("Code(%d)", uint8(c))
+}
+
+// Error 携带状态码的错误
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mrpc: code = %s, msg = %s", e.Code, e.Message)
+}
+
+func New(code Code, msg string) error {
+	return &Error{Code: code, Message: msg}
+}
+
+func Errorf(code Code, format string, args ...any) error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// FromError 从 err 中取出状态错误
+func FromError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// CodeOf 返回 err 对应的状态码
+// nil 为 OK，普通错误为 Unknown
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	if e, ok := FromError(err); ok {
+		return e.Code
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	}
+	return Unknown
+}
+
+// MessageOf 返回 err 中用于传输的错误信息
+func MessageOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	if e, ok := FromError(err); ok {
+		return e.Message
+	}
+	return err.Error()
+}
+
+// ResultCode 返回一次调用的状态码
+// 客户端拦截器中业务错误保存在 resp 中，err 为空
+func ResultCode(resp *message.Response, err error) Code {
+	if err != nil || resp == nil {
+		return CodeOf(err)
+	}
+	if len(resp.Error) == 0 {
+		return OK
+	}
+	if code := Code(resp.Status); code != OK {
+		return code
+	}
+	return Unknown
+}
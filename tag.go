@@ -0,0 +1,23 @@
+package mrpc
+
+import "strings"
+
+const tagName = "mrpc"
+
+// parseTag 解析 mrpc 标签，多个选项以逗号分隔
+// 例如 mrpc:"serializer=proto" 解析为 {"serializer": "proto"}
+func parseTag(tag string) map[string]string {
+	res := make(map[string]string, 2)
+	if tag == "" {
+		return res
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		k, v, _ := strings.Cut(opt, "=")
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		res[k] = strings.TrimSpace(v)
+	}
+	return res
+}
@@ -0,0 +1,39 @@
+package mrpc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseTag(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tag     string
+		wantRes map[string]string
+	}{
+		{
+			name:    "empty",
+			wantRes: map[string]string{},
+		},
+		{
+			name:    "single",
+			tag:     "serializer=proto",
+			wantRes: map[string]string{"serializer": "proto"},
+		},
+		{
+			name:    "multiple",
+			tag:     "serializer=proto, timeout=200ms",
+			wantRes: map[string]string{"serializer": "proto", "timeout": "200ms"},
+		},
+		{
+			name:    "flag",
+			tag:     "-",
+			wantRes: map[string]string{"-": ""},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantRes, parseTag(tc.tag))
+		})
+	}
+}
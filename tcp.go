@@ -2,22 +2,203 @@ package mrpc
 
 import (
 	"encoding/binary"
+	"errors"
+	"github.com/NotFound1911/mrpc/status"
+	"io"
 	"net"
 )
 
+const (
+	// DefaultMaxRecvSize 默认能够接收的最大消息，与网关的默认请求体大小一致
+	DefaultMaxRecvSize = 4 << 20
+
+	// chunkFlag 分块帧的第一个长度字段最高位为 1，普通消息的头部不会这么长
+	chunkFlag uint32 = 1 << 31
+	// maxChunkSize 分块帧能够表示的最大分块
+	maxChunkSize = int(chunkFlag - 1)
+	// chunkLast 分块帧的第二个长度字段为标记位，最后一个分块设置该标记
+	chunkLast uint32 = 1
+)
+
+var errBadFrame = errors.New("mrpc: 消息帧格式错误")
+
+// msgLimits 消息大小限制，为 0 表示不限制
+type msgLimits struct {
+	maxRecv int
+	maxSend int
+	// chunkSize 超过该大小的消息分块发送，为 0 表示不分块
+	chunkSize int
+}
+
+func defaultMsgLimits() msgLimits {
+	return msgLimits{maxRecv: DefaultMaxRecvSize}
+}
+
+func (l msgLimits) checkSend(size int) error {
+	if l.maxSend > 0 && size > l.maxSend {
+		return status.Errorf(status.ResourceExhausted, "消息大小 %d 超过发送限制 %d", size, l.maxSend)
+	}
+	return nil
+}
+
+func msgTooLarge(limit int) error {
+	return status.Errorf(status.ResourceExhausted, "消息大小超过接收限制 %d", limit)
+}
+
+// ReadMsg 读取一个完整的消息，分块发送的消息会被还原
+// 只检查长度字段，解析之前需要使用 message.ValidReq 或 message.ValidResp 检查
 func ReadMsg(conn net.Conn) ([]byte, error) {
-	lenBs := make([]byte, numOfLengthBytes)
+	return readFrame(conn, 0)
+}
 
-	_, err := conn.Read(lenBs)
-	if err != nil {
+// readMsg 读取一个完整的消息，maxSize 大于 0 时限制消息大小
+// valid 检查头部的固定部分与分隔符，例如 message.ValidReq，不合法的消息无法解析，连接也不能继续使用
+// 消息超过限制时丢弃消息体，返回 BodyLength 为 0 的头部和 ResourceExhausted 错误，连接可以继续使用
+// 头部本身超过限制时无法丢弃，返回的头部为 nil，连接不能继续使用
+func readMsg(r io.Reader, maxSize int, valid func(data []byte) bool) ([]byte, error) {
+	data, err := readFrame(r, maxSize)
+	if data != nil && !valid(data) {
+		return nil, errBadFrame
+	}
+	return data, err
+}
+
+// readFrame 按照长度字段读取一个完整的消息，不检查头部的内容
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	lenBs := make([]byte, numOfLengthBytes)
+	if _, err := io.ReadFull(r, lenBs); err != nil {
 		return nil, err
 	}
 	headerLength := binary.BigEndian.Uint32(lenBs[:4])
+	if headerLength&chunkFlag != 0 {
+		return readChunks(r, lenBs, maxSize)
+	}
 	bodyLength := binary.BigEndian.Uint32(lenBs[4:])
-	// 响应长度
-	length := headerLength + bodyLength
+	if headerLength < numOfLengthBytes {
+		return nil, errBadFrame
+	}
+	// 消息长度
+	length := uint64(headerLength) + uint64(bodyLength)
+	if maxSize > 0 && length > uint64(maxSize) {
+		if uint64(headerLength) > uint64(maxSize) {
+			return nil, msgTooLarge(maxSize)
+		}
+		header := make([]byte, headerLength)
+		copy(header, lenBs)
+		if _, err := io.ReadFull(r, header[numOfLengthBytes:]); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(bodyLength)); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(header[4:8], 0)
+		return header, msgTooLarge(maxSize)
+	}
 	data := make([]byte, length)
-	_, err = conn.Read(data[numOfLengthBytes:])
-	copy(data[:numOfLengthBytes], lenBs)
-	return data, err
+	copy(data, lenBs)
+	if _, err := io.ReadFull(r, data[numOfLengthBytes:]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readChunks 读取分块发送的消息，frame 为第一个分块帧的长度字段
+// 所有分块拼接起来是一个完整的普通消息，分块只改变传输的方式，不会降低内存占用
+// 读到长度字段之后按照头部声明的长度（不超过 maxSize）一次分配，之后的分块直接读入，峰值内存等于消息大小
+// 超过 maxSize 时只保留头部，其余部分边读边丢弃
+func readChunks(r io.Reader, frame []byte, maxSize int) ([]byte, error) {
+	var (
+		data = make([]byte, 0, numOfLengthBytes)
+		// want 需要保留的长度，读到长度字段之前只保留长度字段
+		want     = numOfLengthBytes
+		sized    bool
+		tooLarge bool
+	)
+	for {
+		size := int(binary.BigEndian.Uint32(frame[:4]) &^ chunkFlag)
+		last := binary.BigEndian.Uint32(frame[4:])&chunkLast != 0
+		for size > 0 {
+			n := min(size, want-len(data))
+			if n == 0 {
+				if !tooLarge {
+					// 分块的总长度超过了头部声明的长度
+					return nil, errBadFrame
+				}
+				if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+					return nil, err
+				}
+				break
+			}
+			start := len(data)
+			data = data[:start+n]
+			if _, err := io.ReadFull(r, data[start:]); err != nil {
+				return nil, err
+			}
+			size -= n
+			if sized || len(data) < numOfLengthBytes {
+				continue
+			}
+			sized = true
+			headerLength := uint64(binary.BigEndian.Uint32(data[:4]))
+			length := headerLength + uint64(binary.BigEndian.Uint32(data[4:8]))
+			if headerLength < numOfLengthBytes {
+				return nil, errBadFrame
+			}
+			want = int(length)
+			if maxSize > 0 && length > uint64(maxSize) {
+				if headerLength > uint64(maxSize) {
+					return nil, msgTooLarge(maxSize)
+				}
+				tooLarge = true
+				want = int(headerLength)
+			}
+			buf := make([]byte, len(data), want)
+			copy(buf, data)
+			data = buf
+		}
+		if last {
+			break
+		}
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, err
+		}
+		if binary.BigEndian.Uint32(frame[:4])&chunkFlag == 0 {
+			return nil, errBadFrame
+		}
+	}
+	if len(data) < want {
+		// 分块的总长度小于头部声明的长度
+		return nil, errBadFrame
+	}
+	if tooLarge {
+		binary.BigEndian.PutUint32(data[4:8], 0)
+		return data, msgTooLarge(maxSize)
+	}
+	return data, nil
+}
+
+// writeMsg 写入一个完整的消息，chunkSize 大于 0 且消息超过 chunkSize 时分块写入
+// 每个分块帧由两个长度字段和分块数据组成：分块长度（最高位为 1）、标记位
+func writeMsg(w io.Writer, data []byte, chunkSize int) error {
+	if chunkSize <= 0 || len(data) <= chunkSize {
+		_, err := w.Write(data)
+		return err
+	}
+	chunkSize = min(chunkSize, maxChunkSize)
+	frame := make([]byte, numOfLengthBytes)
+	for len(data) > 0 {
+		size := min(chunkSize, len(data))
+		var flags uint32
+		if size == len(data) {
+			flags = chunkLast
+		}
+		binary.BigEndian.PutUint32(frame[:4], chunkFlag|uint32(size))
+		binary.BigEndian.PutUint32(frame[4:], flags)
+		bufs := net.Buffers{frame, data[:size]}
+		if _, err := bufs.WriteTo(w); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
 }
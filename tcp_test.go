@@ -0,0 +1,191 @@
+package mrpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadWriteMsg(t *testing.T) {
+	req := &message.Request{
+		RequestID:   1,
+		Serializer:  1,
+		ServiceName: "user-service",
+		MethodName:  "GetById",
+		Meta:        map[string]string{"trace-id": "123"},
+		Data:        bytes.Repeat([]byte("a"), 1000),
+	}
+	req.CalHeaderLen()
+	req.CalBodyLen()
+	data := message.EncodeReq(req)
+
+	testCases := []struct {
+		name      string
+		chunkSize int
+		maxSize   int
+
+		wantReq  *message.Request
+		wantCode status.Code
+	}{
+		{
+			name:    "whole",
+			wantReq: req,
+		},
+		{
+			name:      "chunked",
+			chunkSize: 100,
+			wantReq:   req,
+		},
+		{
+			name:      "small chunks",
+			chunkSize: 3,
+			wantReq:   req,
+		},
+		{
+			name:      "below chunk size",
+			chunkSize: len(data),
+			wantReq:   req,
+		},
+		{
+			name:    "limit",
+			maxSize: len(data),
+			wantReq: req,
+		},
+		{
+			name:     "too large",
+			maxSize:  len(data) - 1,
+			wantCode: status.ResourceExhausted,
+		},
+		{
+			name:      "chunked too large",
+			chunkSize: 100,
+			maxSize:   500,
+			wantCode:  status.ResourceExhausted,
+		},
+		{
+			name:      "small chunks too large",
+			chunkSize: 3,
+			maxSize:   500,
+			wantCode:  status.ResourceExhausted,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			require.NoError(t, writeMsg(buf, data, tc.chunkSize))
+			// 后面紧跟一个小消息，用于确认读取之后连接仍然可以使用
+			next := &message.Request{ServiceName: "next", MethodName: "Next"}
+			next.CalHeaderLen()
+			require.NoError(t, writeMsg(buf, message.EncodeReq(next), tc.chunkSize))
+
+			// 每次只读一个字节，模拟短读
+			r := iotest.OneByteReader(buf)
+			bs, err := readMsg(r, tc.maxSize, message.ValidReq)
+			if tc.wantCode != status.OK {
+				assert.Equal(t, tc.wantCode, status.CodeOf(err))
+				// 只返回头部
+				got := message.DecodeReq(bs)
+				assert.Equal(t, req.ServiceName, got.ServiceName)
+				assert.Equal(t, req.MethodName, got.MethodName)
+				assert.Equal(t, req.Meta, got.Meta)
+				assert.Nil(t, got.Data)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, data, bs)
+			}
+			bs, err = readMsg(r, tc.maxSize, message.ValidReq)
+			require.NoError(t, err)
+			assert.Equal(t, "next", message.DecodeReq(bs).ServiceName)
+		})
+	}
+}
+
+func TestReadMsgHeaderTooLarge(t *testing.T) {
+	frame := make([]byte, numOfLengthBytes)
+	binary.BigEndian.PutUint32(frame[:4], 1<<20)
+	binary.BigEndian.PutUint32(frame[4:], 10)
+	bs, err := readMsg(bytes.NewReader(frame), 1024, message.ValidReq)
+	assert.Equal(t, status.ResourceExhausted, status.CodeOf(err))
+	// 头部无法丢弃，连接不能继续使用
+	assert.Nil(t, bs)
+}
+
+func TestReadMsgBadFrame(t *testing.T) {
+	chunk := func(size int, flags uint32, data string) []byte {
+		frame := make([]byte, numOfLengthBytes)
+		binary.BigEndian.PutUint32(frame[:4], chunkFlag|uint32(size))
+		binary.BigEndian.PutUint32(frame[4:], flags)
+		return append(frame, data...)
+	}
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "short header length",
+			data: []byte{0, 0, 0, 1, 0, 0, 0, 0},
+		},
+		{
+			name: "header without separators",
+			data: []byte{0, 0, 0, 15, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1},
+		},
+		{
+			name: "chunked header without separators",
+			data: chunk(15, chunkLast, "\x00\x00\x00\x0f\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x01"),
+		},
+		{
+			name: "chunks shorter than length",
+			data: chunk(4, chunkLast, "\x00\x00\x00\x10"),
+		},
+		{
+			name: "length mismatch",
+			data: append(chunk(8, 0, "\x00\x00\x00\x08\x00\x00\x00\x04"), chunk(2, chunkLast, "ab")...),
+		},
+		{
+			name: "plain frame after chunk",
+			data: append(chunk(8, 0, "\x00\x00\x00\x08\x00\x00\x00\x00"), 0, 0, 0, 8, 0, 0, 0, 0),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readMsg(bytes.NewReader(tc.data), 0, message.ValidReq)
+			assert.Equal(t, errBadFrame, err)
+		})
+	}
+
+	// 超过大小限制时只返回头部，头部同样需要检查
+	data := append([]byte{0, 0, 0, 15, 0, 0, 0, 16, 0, 0, 0, 1, 0, 0, 1}, make([]byte, 16)...)
+	bs, err := readMsg(bytes.NewReader(data), 20, message.ValidReq)
+	assert.Equal(t, errBadFrame, err)
+	assert.Nil(t, bs)
+}
+
+func TestReadChunksAlloc(t *testing.T) {
+	req := &message.Request{
+		ServiceName: "user-service",
+		MethodName:  "GetById",
+		Data:        bytes.Repeat([]byte("a"), 8<<20),
+	}
+	req.CalHeaderLen()
+	req.CalBodyLen()
+	data := message.EncodeReq(req)
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeMsg(buf, data, 64<<10))
+	frame := buf.Bytes()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	bs, err := readMsg(bytes.NewReader(frame), 0, message.ValidReq)
+	runtime.ReadMemStats(&after)
+	require.NoError(t, err)
+	assert.Equal(t, data, bs)
+	// 按照声明的长度一次分配，峰值内存不会因为扩容翻倍
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(len(data)+1<<20))
+}
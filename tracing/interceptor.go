@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+)
+
+const (
+	MetaTraceParent = "traceparent"
+	MetaTraceState  = "tracestate"
+)
+
+// 属性名参考 OpenTelemetry RPC 语义约定
+const (
+	AttrRPCSystem    = "rpc.system"
+	AttrRPCService   = "rpc.service"
+	AttrRPCMethod    = "rpc.method"
+	AttrSerializer   = "rpc.mrpc.serializer"
+	AttrRequestSize  = "rpc.mrpc.request.size"
+	AttrResponseSize = "rpc.mrpc.response.size"
+	AttrStatusCode   = "rpc.mrpc.status_code"
+)
+
+func spanName(req *message.Request) string {
+	return req.ServiceName + "/" + req.MethodName
+}
+
+func startAttributes(span *Span, req *message.Request) {
+	span.SetAttribute(AttrRPCSystem, "mrpc")
+	span.SetAttribute(AttrRPCService, req.ServiceName)
+	span.SetAttribute(AttrRPCMethod, req.MethodName)
+	span.SetAttribute(AttrSerializer, req.Serializer)
+	span.SetAttribute(AttrRequestSize, len(req.Data))
+}
+
+func endAttributes(span *Span, resp *message.Response, err error) {
+	if resp != nil {
+		span.SetAttribute(AttrResponseSize, len(resp.Data))
+	}
+	span.SetAttribute(AttrStatusCode, status.ResultCode(resp, err).String())
+	span.RecordError(err)
+}
+
+// ClientInterceptor 创建客户端 span，并将链路信息写入 Request.Meta
+func ClientInterceptor(t *Tracer) mrpc.Interceptor {
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			var parent SpanContext
+			if span, ok := SpanFromCtx(ctx); ok {
+				parent = span.SpanContext
+			}
+			ctx, span := t.Start(ctx, spanName(req), SpanKindClient, parent)
+			defer span.End()
+			startAttributes(span, req)
+			if req.Meta == nil {
+				req.Meta = make(map[string]string, 2)
+			}
+			req.Meta[MetaTraceParent] = span.SpanContext.TraceParent()
+			if span.SpanContext.TraceState != "" {
+				req.Meta[MetaTraceState] = span.SpanContext.TraceState
+			}
+			resp, err := next(ctx, req)
+			endAttributes(span, resp, err)
+			return resp, err
+		}
+	}
+}
+
+// ServerInterceptor 从 Request.Meta 中恢复链路信息并创建服务端 span
+// 业务方法中发起的调用会成为该 span 的子调用
+func ServerInterceptor(t *Tracer) mrpc.Interceptor {
+	return func(next mrpc.HandleFunc) mrpc.HandleFunc {
+		return func(ctx context.Context, req *message.Request) (*message.Response, error) {
+			var parent SpanContext
+			if val, ok := req.Meta[MetaTraceParent]; ok {
+				if sc, err := ParseTraceParent(val); err == nil {
+					sc.TraceState = req.Meta[MetaTraceState]
+					parent = sc
+				}
+			}
+			ctx, span := t.Start(ctx, spanName(req), SpanKindServer, parent)
+			defer span.End()
+			startAttributes(span, req)
+			resp, err := next(ctx, req)
+			endAttributes(span, resp, err)
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"github.com/NotFound1911/mrpc/message"
+	"github.com/NotFound1911/mrpc/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestInterceptor(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler func(ctx context.Context, req *message.Request) (*message.Response, error)
+
+		wantCode string
+		wantErr  string
+	}{
+		{
+			name: "ok",
+			handler: func(ctx context.Context, req *message.Request) (*message.Response, error) {
+				return &message.Response{Data: []byte("hello")}, nil
+			},
+			wantCode: "OK",
+		},
+		{
+			name: "error",
+			handler: func(ctx context.Context, req *message.Request) (*message.Response, error) {
+				return &message.Response{}, status.New(status.NotFound, "user not found")
+			},
+			wantCode: "NotFound",
+			wantErr:  "mrpc: code = NotFound, msg = user not found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter := NewInMemoryExporter()
+			tracer := NewTracer(exporter)
+			// 客户端拦截器直接调用服务端拦截器，模拟一次远程调用
+			server := ServerInterceptor(tracer)(func(ctx context.Context, req *message.Request) (*message.Response, error) {
+				span, ok := SpanFromCtx(ctx)
+				require.True(t, ok)
+				assert.Equal(t, SpanKindServer, span.Kind)
+				return tc.handler(ctx, req)
+			})
+			client := ClientInterceptor(tracer)(server)
+
+			parentCtx, parent := tracer.Start(context.Background(), "parent", SpanKindServer, SpanContext{})
+			_, _ = client(parentCtx, &message.Request{
+				ServiceName: "user-service",
+				MethodName:  "GetById",
+				Serializer:  1,
+				Data:        []byte(`{"Id":123}`),
+			})
+			parent.End()
+
+			spans := exporter.Spans()
+			require.Len(t, spans, 3)
+			serverSpan, clientSpan := spans[0], spans[1]
+			assert.Equal(t, "user-service/GetById", clientSpan.Name)
+			assert.Equal(t, "user-service/GetById", serverSpan.Name)
+			// 同一条链路
+			assert.Equal(t, parent.SpanContext.TraceID, clientSpan.SpanContext.TraceID)
+			assert.Equal(t, parent.SpanContext.TraceID, serverSpan.SpanContext.TraceID)
+			assert.Equal(t, parent.SpanContext.SpanID, clientSpan.ParentSpanID)
+			assert.Equal(t, clientSpan.SpanContext.SpanID, serverSpan.ParentSpanID)
+
+			for _, span := range []*Span{clientSpan, serverSpan} {
+				assert.Equal(t, tc.wantCode, span.Attributes[AttrStatusCode])
+				assert.Equal(t, uint8(1), span.Attributes[AttrSerializer])
+				assert.Equal(t, 10, span.Attributes[AttrRequestSize])
+				assert.Equal(t, tc.wantErr, span.Err)
+			}
+		})
+	}
+}
+
+func TestServerInterceptor_Unsampled(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	h := ServerInterceptor(NewTracer(exporter))(func(ctx context.Context, req *message.Request) (*message.Response, error) {
+		return &message.Response{}, nil
+	})
+	_, err := h(context.Background(), &message.Request{
+		Meta: map[string]string{
+			MetaTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, exporter.Spans())
+}
@@ -0,0 +1,221 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+const flagSampled = 0x01
+
+// SpanContext 需要跨进程传递的链路信息，对应 W3C Trace Context
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// TraceParent 按 W3C 格式输出 traceparent
+// 例如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) TraceParent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+var errInvalidTraceParent = errors.New("tracing: traceparent 格式错误")
+
+// ParseTraceParent 解析 W3C traceparent
+func ParseTraceParent(val string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(val, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, errInvalidTraceParent
+	}
+	// 版本 00 只能有四段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errInvalidTraceParent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errInvalidTraceParent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errInvalidTraceParent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errInvalidTraceParent
+	}
+	flags := make([]byte, 1)
+	if _, err := hex.Decode(flags, []byte(parts[3])); err != nil {
+		return sc, errInvalidTraceParent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, errInvalidTraceParent
+	}
+	return sc, nil
+}
+
+type SpanKind uint8
+
+const (
+	SpanKindClient SpanKind = iota + 1
+	SpanKindServer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindClient:
+		return "client"
+	case SpanKindServer:
+		return "server"
+	}
+	return "unspecified"
+}
+
+// Span 一次调用在某一端的记录
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]any
+	// Err 调用失败时的错误信息
+	Err string
+
+	tracer *Tracer
+	mutex  sync.Mutex
+	ended  bool
+}
+
+func (s *Span) SetAttribute(key string, val any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Attributes[key] = val
+}
+
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Err = err.Error()
+}
+
+// End 结束 span 并导出，重复调用无效
+func (s *Span) End() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mutex.Unlock()
+	if s.SpanContext.IsSampled() {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// Exporter 将结束的 span 发送到外部系统
+type Exporter interface {
+	Export(span *Span)
+}
+
+// InMemoryExporter 将 span 保存在内存中，用于测试
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Export(span *Span) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	res := make([]*Span, len(e.spans))
+	copy(res, e.spans)
+	return res
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
+
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+	}
+}
+
+// Start 创建 span，parent 有效时继承其 trace，否则开启新的 trace
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, parent SpanContext) (context.Context, *Span) {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]any, 8),
+		tracer:     t,
+	}
+	if parent.IsValid() {
+		span.SpanContext = parent
+		span.ParentSpanID = parent.SpanID
+	} else {
+		_, _ = rand.Read(span.SpanContext.TraceID[:])
+		span.SpanContext.Flags = flagSampled
+	}
+	_, _ = rand.Read(span.SpanContext.SpanID[:])
+	return CtxWithSpan(ctx, span), span
+}
+
+type spanKey struct{}
+
+func CtxWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromCtx 获取当前调用的 span
+func SpanFromCtx(ctx context.Context) (*Span, bool) {
+	span, ok := ctx.Value(spanKey{}).(*Span)
+	return span, ok
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	testCases := []struct {
+		name    string
+		val     string
+		wantRes SpanContext
+		wantErr error
+	}{
+		{
+			name: "sampled",
+			val:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantRes: SpanContext{
+				TraceID: TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+				SpanID:  SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+				Flags:   1,
+			},
+		},
+		{
+			name: "future version",
+			val:  "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+			wantRes: SpanContext{
+				TraceID: TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+				SpanID:  SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+			},
+		},
+		{
+			name:    "extra fields in version 00",
+			val:     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			wantErr: errInvalidTraceParent,
+		},
+		{
+			name:    "invalid version",
+			val:     "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantErr: errInvalidTraceParent,
+		},
+		{
+			name:    "zero trace id",
+			val:     "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			wantErr: errInvalidTraceParent,
+		},
+		{
+			name:    "not hex",
+			val:     "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+			wantErr: errInvalidTraceParent,
+		},
+		{
+			name:    "too short",
+			val:     "00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+			wantErr: errInvalidTraceParent,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := ParseTraceParent(tc.val)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantRes, sc)
+		})
+	}
+}
+
+func TestSpanContext_TraceParent(t *testing.T) {
+	val := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(val)
+	assert.NoError(t, err)
+	assert.Equal(t, val, sc.TraceParent())
+}
@@ -12,3 +12,17 @@ type Service interface {
 type Proxy interface {
 	Invoke(ctx context.Context, req *message.Request) (*message.Response, error)
 }
+
+// HandleFunc 处理一次调用，客户端与服务端共用
+type HandleFunc func(ctx context.Context, req *message.Request) (*message.Response, error)
+
+// Interceptor 拦截器，可以在调用前后插入逻辑，例如认证、日志
+type Interceptor func(next HandleFunc) HandleFunc
+
+// chainInterceptors 按顺序组装拦截器，第一个拦截器位于最外层
+func chainInterceptors(h HandleFunc, interceptors []Interceptor) HandleFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		h = interceptors[i](h)
+	}
+	return h
+}
@@ -8,8 +8,51 @@ import (
 )
 
 type UserService struct {
-	GetById      func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) // 一个GetById方法
-	GetByIdProto func(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error)
+	GetById      func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)         // 一个GetById方法
+	GetByIdProto func(ctx context.Context, req *gen.GetByIdReq) (*gen.GetByIdResp, error) `mrpc:"serializer=proto"`
+}
+
+// UserServiceUnknownSerializer 使用了未注册的序列化协议
+type UserServiceUnknownSerializer struct {
+	GetById func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) `mrpc:"serializer=xml"`
+}
+
+func (u UserServiceUnknownSerializer) Name() string {
+	return "user-service"
+}
+
+// UserServiceInvalid 字段类型不符合要求
+type UserServiceInvalid struct {
+	Timeout   time.Duration
+	NoContext func(req *GetByIdReq) (*GetByIdResp, error)
+	NoPointer func(ctx context.Context, req *GetByIdReq) (GetByIdResp, error)
+	NoName    func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) `mrpc:"name="`
+	BadTime   func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) `mrpc:"timeout=abc"`
+	Skipped   string                                                           `mrpc:"-"`
+}
+
+func (u UserServiceInvalid) Name() string {
+	return "user-service"
+}
+
+// UserServiceTimeout 通过标签指定默认超时时间
+type UserServiceTimeout struct {
+	GetById  func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) `mrpc:"timeout=200ms"`
+	GetByIds func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error)
+}
+
+func (u UserServiceTimeout) Name() string {
+	return "user-service"
+}
+
+// UserServiceRename 通过标签指定远程方法名
+type UserServiceRename struct {
+	Get    func(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) `mrpc:"name=GetById"`
+	Helper func() string                                                    `mrpc:"-"`
+}
+
+func (u UserServiceRename) Name() string {
+	return "user-service"
 }
 
 func (u UserService) Name() string {
@@ -63,3 +106,20 @@ func (u *UserServiceServerTimeout) GetById(ctx context.Context, req *GetByIdReq)
 func (u *UserServiceServerTimeout) Name() string {
 	return "user-service"
 }
+
+// UserServiceServerMeta 将收到的元数据原样返回
+type UserServiceServerMeta struct {
+}
+
+func (u *UserServiceServerMeta) GetById(ctx context.Context, req *GetByIdReq) (*GetByIdResp, error) {
+	meta := IncomingMeta(ctx)
+	if err := SetTrailer(ctx, "tenant", meta["tenant"]); err != nil {
+		return nil, err
+	}
+	return &GetByIdResp{
+		Msg: meta["request-id"],
+	}, nil
+}
+func (u *UserServiceServerMeta) Name() string {
+	return "user-service"
+}